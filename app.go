@@ -19,12 +19,24 @@ type App struct {
 	Path            string
 	Root            string
 	Target          string
+	Targets         []string
+	Mappings        []Mapping `yaml:"-"`
 	Definition      string
-	Variables       []string
+	Variables       []Variable
 	VariableNames   []string
+	Schema          map[string]*Variable `yaml:"-"`
 	ExportVariables map[string]string
+	Secrets         []string
+	ConfirmSecrets  bool `yaml:"confirm_secrets"`
+	Template        string
 	LoadAction      string `yaml:"load"`
 	UnloadAction    string `yaml:"unload"`
+	Home            string `yaml:"-"`
+	Session         string `yaml:"-"`
+	// Separator joins the items of lists in environment files, "," by default
+	Separator string
+	// Format is what environment files are written in, yaml by default
+	Format string
 }
 
 // NewApp is the constructor for New Apps
@@ -33,6 +45,8 @@ func NewApp(name string, sswHome string) (*App, error) {
 	a.Name = name
 	a.Definition = path.Join(sswHome, "config", name+".ssw")
 	a.Path = path.Join(sswHome, name)
+	a.Home = sswHome
+	a.Session = os.Getenv("SSW_SESSION")
 	Logger.Debugf("Parsing application found at %s", a.Path)
 	if data, err := ioutil.ReadFile(a.Definition); err != nil {
 		Logger.Errorln(err.Error())
@@ -42,16 +56,20 @@ func NewApp(name string, sswHome string) (*App, error) {
 			return a, err
 		}
 
-		if a.EnvType == "directory" {
-			Logger.Debugf("Target for %s is currently %s", a.Name, a.Target)
-			if newTarget, err := expandPath(a.Target); err != nil {
-				Logger.Debugf(err.Error())
-				return a, err
-			} else {
-				Logger.Debugf("New target for %s is %s", a.Name, newTarget)
-				a.Target = newTarget
+		if a.EnvType == "directory" || a.EnvType == "file" {
+			if err := a.ParseMappings(); err != nil {
+				Logger.Debugf("%s", err.Error())
 				return a, err
 			}
+			// templates for new environments are relative to the config directory
+			if a.Template != "" && !strings.HasPrefix(a.Template, "~") && !path.IsAbs(a.Template) {
+				a.Template = path.Join(sswHome, "config", a.Template)
+			} else if a.Template != "" {
+				if a.Template, err = expandPath(a.Template); err != nil {
+					return a, err
+				}
+			}
+			return a, nil
 		} else {
 			if err := a.ParseExportVars(); err != nil {
 				return a, err
@@ -59,31 +77,113 @@ func NewApp(name string, sswHome string) (*App, error) {
 		}
 		return a, nil
 	}
-	return a, nil
 }
 
+// ParseMappings turns target and the targets list into Mappings. target links the
+// whole environment, while each entry of targets links a file or subdirectory
+// inside the environment in the form source -> target
+func (a *App) ParseMappings() error {
+	a.Mappings = make([]Mapping, 0)
+	if a.Target != "" {
+		Logger.Debugf("Target for %s is currently %s", a.Name, a.Target)
+		if newTarget, err := expandPath(a.Target); err != nil {
+			return err
+		} else {
+			Logger.Debugf("New target for %s is %s", a.Name, newTarget)
+			a.Target = newTarget
+			a.Mappings = append(a.Mappings, Mapping{Source: ".", Target: newTarget})
+		}
+	}
+	if a.EnvType == "file" && len(a.Targets) > 0 {
+		return errors.New(fmt.Sprintf("Application %s of type file takes a single target, not targets", a.Name))
+	}
+	for i := range a.Targets {
+		if m, err := parseMapping(a.Targets[i]); err != nil {
+			return err
+		} else {
+			a.Mappings = append(a.Mappings, m)
+		}
+	}
+	if len(a.Mappings) == 0 {
+		return errors.New(fmt.Sprintf("Application %s of type %s needs a target", a.Name, a.EnvType))
+	}
+	return nil
+}
+
+// ParseExportVars merges the entries of the variables list into the Schema, one
+// Variable per key, and maps each environment variable name to its key
 func (a *App) ParseExportVars() error {
+	if a.Format != "" && !contains(envFormats, a.Format) {
+		return errors.New(fmt.Sprintf("Format %s for application %s is not one of %s", a.Format, a.Name,
+			strings.Join(envFormats, ", ")))
+	}
 	a.VariableNames = make([]string, 0)
 	a.ExportVariables = make(map[string]string, len(a.Variables))
+	a.Schema = make(map[string]*Variable, len(a.Variables))
 	for i := range a.Variables {
-		keyValue := strings.Split(a.Variables[i], "=")
-		a.VariableNames = appendIfMissing(a.VariableNames, keyValue[0])
-		a.ExportVariables[keyValue[1]] = keyValue[0]
+		v := a.Variables[i]
+		if v.Key == "" || len(v.Env) == 0 {
+			return errors.New(fmt.Sprintf("Variable %d for application %s needs a key and an environment variable name",
+				i+1, a.Name))
+		}
+		if v.Key == extendsKey {
+			return errors.New(fmt.Sprintf("Variable %d for application %s cannot be called %s, "+
+				"environments use it to name the environment they extend", i+1, a.Name, extendsKey))
+		}
+		for _, envName := range v.Env {
+			if !isValidIdentifier(envName) {
+				return errors.New(fmt.Sprintf("%s for application %s is not a valid environment variable name",
+					envName, a.Name))
+			}
+			if key, ok := a.ExportVariables[envName]; ok && key != v.Key {
+				return errors.New(fmt.Sprintf("%s for application %s is exported for both %s and %s",
+					envName, a.Name, key, v.Key))
+			}
+			a.ExportVariables[envName] = v.Key
+		}
+		if existing, ok := a.Schema[v.Key]; ok {
+			existing.merge(&v)
+		} else {
+			a.VariableNames = append(a.VariableNames, v.Key)
+			a.Schema[v.Key] = &v
+		}
+	}
+	for _, key := range a.VariableNames {
+		if err := a.Schema[key].compile(); err != nil {
+			return errors.New(fmt.Sprintf("Application %s: %s", a.Name, err.Error()))
+		}
+		if a.Schema[key].Secret {
+			a.Secrets = appendIfMissing(a.Secrets, key)
+		}
+	}
+	for _, secret := range a.Secrets {
+		if !contains(a.VariableNames, secret) {
+			return errors.New(fmt.Sprintf("Secret %s for application %s is not one of its variables",
+				secret, a.Name))
+		}
 	}
 	return nil
 }
 
+// currentLink is the symlink to the current environment of the application. In
+// session mode the session's selection, if any, shadows the global one
+func (a *App) currentLink() string {
+	if a.Session != "" {
+		link := path.Join(sessionsDir(a.Home), a.Session, a.Name)
+		if _, err := os.Lstat(link); err == nil {
+			return link
+		}
+	}
+	return path.Join(a.Path, "current")
+}
+
 func (a *App) Current() (*Env, error) {
 	var e *Env
-	if realPath, err := resolveSymlink(path.Join(a.Path, "current")); err != nil {
+	if realPath, err := resolveSymlink(a.currentLink()); err != nil {
 		return e, err
 	} else {
 		envName := path.Base(realPath)
-		if a.EnvType == "environment" {
-			return NewEnvironmentEnv(envName, a.Path, a.ExportVariables, a.VariableNames)
-		} else {
-			return NewDirectoryEnv(envName, a.Path)
-		}
+		return a.NewEnv(envName)
 	}
 
 }
@@ -93,13 +193,9 @@ func (a *App) ListEnvs() []*Env {
 	di, _ := ioutil.ReadDir(a.Path)
 	for i := range di {
 		name := di[i].Name()
-		if name != "current" {
-			var e *Env
-			if a.EnvType == "environment" {
-				e, _ = NewEnvironmentEnv(name, a.Path, a.ExportVariables, a.VariableNames)
-			} else {
-				e, _ = NewDirectoryEnv(name, a.Path)
-			}
+		// dot files are temporary symlinks and other bookkeeping, not environments
+		if name != "current" && !strings.HasPrefix(name, ".") {
+			e, _ := a.NewEnv(name)
 			envs = append(envs, e)
 		}
 	}
@@ -107,40 +203,57 @@ func (a *App) ListEnvs() []*Env {
 }
 
 func (a *App) runAction(actionName string) error {
-	var action string
 	if current, err := a.Current(); err != nil {
 		return err
 	} else {
-		currentPath := current.Path
-		if actionName == "load" {
-			action = a.LoadAction
-		} else if actionName == "unload" {
-			Logger.Debugf("Unload action is %s\n", a.UnloadAction)
-			action = a.UnloadAction
-		} else {
-			return errors.New("Only actions load and unload are valid.")
-		}
-		shell := os.Getenv("SHELL")
-		cmd := exec.Command(shell, "-c", action)
-		envVar := fmt.Sprintf("SSW_CURRENT=%s", currentPath)
-		cmd.Env = append(os.Environ(), envVar)
-		return cmd.Run()
+		return a.runEnvAction(actionName, current)
 	}
 }
 
+// runEnvAction runs the load or unload action with SSW_CURRENT set to env, which
+// need not be the current environment
+func (a *App) runEnvAction(actionName string, env *Env) error {
+	var action string
+	if actionName == "load" {
+		action = a.LoadAction
+	} else if actionName == "unload" {
+		Logger.Debugf("Unload action is %s\n", a.UnloadAction)
+		action = a.UnloadAction
+	} else {
+		return errors.New("Only actions load and unload are valid.")
+	}
+	if action == "" {
+		return nil
+	}
+	shell := os.Getenv("SHELL")
+	cmd := exec.Command(shell, "-c", action)
+	envVar := fmt.Sprintf("SSW_CURRENT=%s", env.Path)
+	cmd.Env = append(os.Environ(), envVar)
+	if err := cmd.Run(); err != nil {
+		return errors.New(fmt.Sprintf("The %s action of application %s failed for environment %s: %s",
+			actionName, a.Name, env.Name, err.Error()))
+	}
+	return nil
+}
+
 func (a *App) Load() error {
+	var env *Env
+	if a.EnvType == "environment" {
+		var err error
+		if env, err = a.Current(); err != nil {
+			Logger.Debugf("No current environment for %s: %s", a.Name, err.Error())
+			return err
+		} else if err := env.Validate(); err != nil {
+			return err
+		}
+	}
 	if err := a.runAction("load"); err != nil {
 		return err
 	} else {
-		if a.EnvType == "environment" {
+		if env != nil {
 			Logger.Debugf("Exporting environment variables for application %s\n", a.Name)
-			if env, err := a.Current(); err == nil {
-				env.Load()
-				return nil
-			} else {
-				Logger.Error(err.Error())
-				return err
-			}
+			env.Load()
+			return nil
 		} else {
 			Logger.Debugf("Application %s has no environment variables to export, nothing to do\n", a.Name)
 			return nil
@@ -153,15 +266,9 @@ func (a *App) Unload() error {
 		return err
 	} else {
 		if a.EnvType == "environment" {
-			Logger.Debugf("Exporting environment variables for application %s\n", a.Name)
+			Logger.Debugf("Unsetting environment variables for application %s\n", a.Name)
 			a.UnsetExportVars()
-			if env, err := a.Current(); err == nil {
-				env.Load()
-				return nil
-			} else {
-				Logger.Error(err.Error())
-				return err
-			}
+			return nil
 		} else {
 			Logger.Debugf("Application %s has no environment variables to export, nothing to do\n", a.Name)
 			return nil
@@ -169,11 +276,44 @@ func (a *App) Unload() error {
 	}
 }
 
+// RollbackError reports a failed switch together with the outcome of switching
+// back to the Previous environment
+type RollbackError struct {
+	Err         error
+	RollbackErr error
+	Previous    string
+}
+
+func (e *RollbackError) Error() string {
+	previous := e.Previous
+	if previous == "" {
+		previous = "no environment"
+	}
+	if e.RollbackErr != nil {
+		return fmt.Sprintf("%s. Rolling back to %s failed as well: %s", e.Err.Error(), previous,
+			e.RollbackErr.Error())
+	}
+	return fmt.Sprintf("%s. Rolled back to %s", e.Err.Error(), previous)
+}
+
+// MakeCurrent switches the application to envName. The application is locked
+// for the duration and every symlink is replaced in a single step, so that
+// neither a crash nor a concurrent switch leaves it without a current environment.
+// If linking or loading envName fails, the previous environment is linked and
+// loaded again and a *RollbackError is returned. The unload action of envName
+// runs before rolling back from a failed load
 func (a *App) MakeCurrent(envName string) error {
 	red := GetTermPrinterF(color.FgRed)
 	envPath := path.Join(a.Path, envName)
+	unlock, err := a.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	currentEnv, currentErr := a.Current()
-	Logger.Debugf("Current env is %s", currentEnv.Name)
+	if currentErr == nil {
+		Logger.Debugf("Current env is %s", currentEnv.Name)
+	}
 	if _, err := os.Stat(envPath); os.IsNotExist(err) {
 		Logger.Error(err.Error())
 		return err
@@ -181,34 +321,93 @@ func (a *App) MakeCurrent(envName string) error {
 		Logger.Warn(red("%s is already set as the default environment for application %s. Nothing to do.",
 			envName, a.Name))
 		return nil
-	} else {
-		var newEnv *Env
-		if a.EnvType == "environment" {
-			newEnv, err = NewEnvironmentEnv(envName, a.Path, a.ExportVariables, a.VariableNames)
-			newEnv.PopulateExportVars()
-			a.Unload()
-			newEnv.PrintExports()
-		} else {
-			newEnv, err = NewDirectoryEnv(envName, a.Path)
+	}
+	// find out about missing sources before changing anything
+	for _, m := range a.Mappings {
+		if err := m.check(envPath); err != nil {
+			return err
+		}
+	}
+	previous := ""
+	if source, err := resolveSymlink(path.Join(a.Path, "current")); err == nil {
+		previous = path.Base(source)
+	}
+	if currentErr != nil {
+		Logger.Debugf("No current environment for %s, nothing to unload", a.Name)
+	} else if err := a.Unload(); err != nil {
+		Logger.Debugf("Unloading hit error %s\n", err.Error())
+		return err
+	}
+	if err := a.Link(envName); err != nil {
+		return &RollbackError{Err: err, RollbackErr: a.rollback(previous), Previous: previous}
+	}
+	if err := a.Load(); err != nil {
+		// the load action may have done part of its work before failing
+		if unloadErr := a.runAction("unload"); unloadErr != nil {
+			Logger.Warnln(unloadErr.Error())
+		}
+		return &RollbackError{Err: err, RollbackErr: a.rollback(previous), Previous: previous}
+	}
+	return nil
+}
+
+// rollback links and loads the previous environment again, or unlinks the
+// application if there was none. The caller must hold the lock
+func (a *App) rollback(previous string) error {
+	Logger.Debugf("Rolling back %s to %s", a.Name, previous)
+	if previous == "" {
+		return a.unlink()
+	}
+	if err := a.Link(previous); err != nil {
+		return err
+	}
+	return a.Load()
+}
+
+// MakeSessionCurrent makes envName the current environment of the application
+// for the session in $SSW_SESSION only, leaving the global current symlink alone.
+// Only environment applications can be scoped to a session as the targets of
+// other types are shared by every terminal. The application is locked for the
+// duration
+func (a *App) MakeSessionCurrent(envName string) error {
+	if a.EnvType != "environment" {
+		return errors.New(fmt.Sprintf("Application %s of type %s cannot be scoped to a session",
+			a.Name, a.EnvType))
+	}
+	unlock, err := a.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	envPath := path.Join(a.Path, envName)
+	if _, err := os.Stat(envPath); err != nil {
+		return err
+	}
+	if current, err := a.Current(); err == nil {
+		if current.Name == envName {
+			Logger.Warnf("%s is already the environment for application %s. Nothing to do.", envName, a.Name)
+			return nil
 		}
-		Logger.Debugf("Unloading %s", a.Name)
 		if err := a.Unload(); err != nil {
-			Logger.Debugf("Unloading hit error %s\n", err.Error())
 			return err
-		} else {
-			Logger.Debugf("Unlinking %s", currentEnv)
-			if err := a.Unlink(); err != nil {
-				Logger.Debugf("Encountered error when unlinking current for %s", a.Name)
-				return err
-			} else {
-				if err := a.Link(newEnv.Name); err != nil {
-					return err
-				} else {
-					return a.Load()
-				}
-			}
 		}
 	}
+	if s, err := NewSession(a.Home, a.Session); err != nil {
+		return err
+	} else if err := s.Link(a.Name, envPath); err != nil {
+		return err
+	}
+	return a.Load()
+}
+
+// UnlinkSession drops the session's selection for the application, falling back
+// to the global current environment
+func (a *App) UnlinkSession() error {
+	if s, err := NewSession(a.Home, a.Session); err != nil {
+		return err
+	} else {
+		return s.Unlink(a.Name)
+	}
 }
 
 func (a *App) EnumerateExportVars() []string {
@@ -221,55 +420,107 @@ func (a *App) EnumerateExportVars() []string {
 	return vars
 }
 
-func (a *App) MakeUnsetExportVars() string {
+func (a *App) MakeUnsetExportVars(sh Shell) string {
 	vars := a.EnumerateExportVars()
 	statements := make([]string, 0)
 	for i := range vars {
-		statements = append(statements, fmt.Sprintf("unset %s", vars[i]))
+		statements = append(statements, sh.Unset(vars[i]))
 	}
 	sort.Strings(statements)
 	return strings.Join(statements, "\n")
 }
 
 func (a *App) UnsetExportVars() {
-	fmt.Printf(a.MakeUnsetExportVars())
+	fmt.Fprintln(EvalOut, a.MakeUnsetExportVars(OutputShell))
 }
 
 func (a *App) Unlink() error {
+	unlock, err := a.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return a.unlink()
+}
+
+func (a *App) unlink() error {
 	current := path.Join(a.Path, "current")
 	if _, err := os.Lstat(current); os.IsNotExist(err) {
 		Logger.Debugf("Current symlink %s does not exist, nothing to do", current)
 		return nil
 	} else {
-		if a.EnvType == "directory" {
-			Logger.Debugf("Removing Target symlink for %s at %s", a.Name, a.Target)
-			if err := os.Remove(a.Target); err != nil {
-				return err
+		// remove as many targets as we can even if one of them fails
+		var unlinkErr error
+		for _, m := range a.Mappings {
+			if _, err := os.Lstat(m.Target); os.IsNotExist(err) {
+				continue
+			}
+			if !a.isOwnLink(m.Target) {
+				Logger.Warnf("Not removing %s as it was not created by sellsword", m.Target)
+				continue
+			}
+			Logger.Debugf("Removing Target symlink for %s at %s", a.Name, m.Target)
+			if err := os.Remove(m.Target); err != nil && unlinkErr == nil {
+				unlinkErr = err
 			}
 		}
+		if unlinkErr != nil {
+			return unlinkErr
+		}
 		return os.Remove(path.Join(a.Path, "current"))
 	}
 }
 
+// Link links envName as current and to all of the application's targets. Each
+// symlink is replaced in a single step, with current last. If any target cannot
+// be linked, the targets already switched are pointed back where they were
 func (a *App) Link(envName string) error {
 	source := path.Join(a.Path, envName)
-	target := path.Join(a.Path, "current")
-	if err := os.Symlink(source, target); err != nil {
-		Logger.Debugf(err.Error())
+	current := path.Join(a.Path, "current")
+	if err := a.clearTargets(); err != nil {
 		return err
 	}
-	if a.EnvType == "directory" {
-		if err := os.Symlink(source, a.Target); err != nil {
-			Logger.Debugf(err.Error())
+	previous := make([]string, len(a.Mappings))
+	for i, m := range a.Mappings {
+		previous[i], _ = resolveSymlink(m.Target)
+	}
+	for i, m := range a.Mappings {
+		if err := m.link(source); err != nil {
+			Logger.Debugf("%s", err.Error())
+			a.revertTargets(previous[:i])
 			return err
 		}
 	}
+	if err := replaceSymlink(source, current); err != nil {
+		Logger.Debugf("%s", err.Error())
+		return err
+	}
 	return nil
 }
 
+// revertTargets points the first len(previous) targets back at their previous
+// sources, removing those that had none
+func (a *App) revertTargets(previous []string) {
+	for i := range previous {
+		if previous[i] == "" {
+			os.Remove(a.Mappings[i].Target)
+		} else if err := replaceSymlink(previous[i], a.Mappings[i].Target); err != nil {
+			Logger.Errorf("Could not point %s back at %s: %s", a.Mappings[i].Target, previous[i], err.Error())
+		}
+	}
+}
+
 func (a *App) NewEnv(envName string) (*Env, error) {
 	if a.EnvType == "environment" {
-		return NewEnvironmentEnv(envName, a.Path, a.ExportVariables, a.VariableNames)
+		env := newEnv(envName, a.Path, a.ExportVariables, a.VariableNames, "environment")
+		env.Secrets = a.Secrets
+		env.ConfirmSecrets = a.ConfirmSecrets
+		env.Separator = a.Separator
+		env.Format = a.Format
+		env.Schema = a.Schema
+		return env, env.readVariables()
+	} else if a.EnvType == "file" {
+		return NewFileEnv(envName, a.Path, a.Template)
 	} else {
 		return NewDirectoryEnv(envName, a.Path)
 	}
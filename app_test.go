@@ -2,6 +2,7 @@ package sellsword
 
 import (
 	"fmt"
+	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"os"
 	"path"
@@ -60,6 +61,26 @@ func TestNewAppParsingExportVars(t *testing.T) {
 	}
 }
 
+func TestParseExportVarsRejectsInvalidNames(t *testing.T) {
+	setUpTest()
+	invalid := []string{"[region=AWS-REGION]", "[region=$(id)]", "[region AWS_REGION]",
+		"[{key: region, env: [AWS_REGION, 1AWS]}]", "[{env: AWS_REGION}]"}
+	for i := range invalid {
+		var raw []interface{}
+		if err := yaml.Unmarshal([]byte(invalid[i]), &raw); err != nil {
+			t.Fatalf("Expected variables %v to be valid YAML, found %s", invalid[i], err.Error())
+		}
+		a := &App{Name: "aws"}
+		err := yaml.Unmarshal([]byte("variables: "+invalid[i]), a)
+		if err == nil {
+			err = a.ParseExportVars()
+		}
+		if err == nil {
+			t.Errorf("Expected error when parsing variables %v but did not receive one", invalid[i])
+		}
+	}
+}
+
 // test that Current returns correct link
 func TestAppCheckCurrent(t *testing.T) {
 	setUpTest()
@@ -77,6 +98,7 @@ func TestAppCheckCurrent(t *testing.T) {
 // test that Current returns correct link for a Directory environment
 func TestAppDirectoryCheckCurrent(t *testing.T) {
 	setUpTest()
+	setUpFixtures(t)
 	wd, _ := os.Getwd()
 	source := path.Join(wd, "test/chef/acme")
 	currentLink := path.Join(wd, "test/chef/current")
@@ -97,6 +119,7 @@ func TestAppDirectoryCheckCurrent(t *testing.T) {
 // test that Unlink removes current link and target directory
 func TestAppUnlink(t *testing.T) {
 	setUpTest()
+	setUpFixtures(t)
 	wd, _ := os.Getwd()
 	source := path.Join(wd, "test/chef/acme")
 	currentLink := path.Join(wd, "test/chef/current")
@@ -116,7 +139,7 @@ func TestAppUnsetVars(t *testing.T) {
 	setUpTest()
 	wd, _ := os.Getwd()
 	a, _ := NewApp("aws", path.Join(wd, "test"))
-	unsets := strings.TrimSpace(a.MakeUnsetExportVars())
+	unsets := strings.TrimSpace(a.MakeUnsetExportVars(bashShell{}))
 	expected := strings.TrimSpace(`unset AWS_ACCESS_ID
 unset AWS_ACCESS_KEY_ID
 unset AWS_DEFAULT_REGION
@@ -129,6 +152,36 @@ unset AWS_SECRET_KEY
 	}
 }
 
+func TestAppUnsetVarsFish(t *testing.T) {
+	setUpTest()
+	wd, _ := os.Getwd()
+	a, _ := NewApp("aws", path.Join(wd, "test"))
+	unsets := strings.TrimSpace(a.MakeUnsetExportVars(fishShell{}))
+	expected := strings.TrimSpace(`set -e AWS_ACCESS_ID
+set -e AWS_ACCESS_KEY_ID
+set -e AWS_DEFAULT_REGION
+set -e AWS_REGION
+set -e AWS_SECRET_ACCESS_KEY
+set -e AWS_SECRET_KEY
+`)
+	if unsets != expected {
+		t.Errorf("Expected %s and found %s", expected, unsets)
+	}
+}
+
+func TestAppUnsetVarsZshAndPosix(t *testing.T) {
+	setUpTest()
+	wd, _ := os.Getwd()
+	a, _ := NewApp("aws", path.Join(wd, "test"))
+	expected := strings.TrimSpace(a.MakeUnsetExportVars(bashShell{}))
+	for _, sh := range []Shell{zshShell{}, posixShell{}} {
+		unsets := strings.TrimSpace(a.MakeUnsetExportVars(sh))
+		if unsets != expected {
+			t.Errorf("Expected %s unset statements to be %s and found %s", sh.Name(), expected, unsets)
+		}
+	}
+}
+
 // ListEnvs returns correct list
 func TestListEnvs(t *testing.T) {
 	setUpTest()
@@ -151,12 +204,120 @@ func TestListEnvs(t *testing.T) {
 func TestAppMakeCurrent(t *testing.T) {
 	setUpTest()
 	wd, _ := os.Getwd()
+	relink(path.Join(wd, "test/aws/dyncorp"), path.Join(wd, "test/aws/current"))
 	a, _ := NewApp("aws", path.Join(wd, "test"))
-	dyncorpPath := path.Join(wd, "test/aws/dyncorp")
-	a.MakeCurrent("dyncorp")
+	acmePath := path.Join(wd, "test/aws/acme")
+	a.MakeCurrent("acme")
 	source, _ := os.Readlink(path.Join(wd, "test/aws/current"))
-	if source != dyncorpPath {
-		t.Errorf("Expected make current to set source to %s, found %s", source, dyncorpPath)
+	if source != acmePath {
+		t.Errorf("Expected make current to set source to %s, found %s", acmePath, source)
+	}
+	// dyncorp is invalid yaml so it cannot be loaded and acme must stay current
+	if err := a.MakeCurrent("dyncorp"); err == nil {
+		t.Error("Expected error switching to invalid env dyncorp but did not receive one")
+	}
+	source, _ = os.Readlink(path.Join(wd, "test/aws/current"))
+	if source != acmePath {
+		t.Errorf("Expected failed switch to leave source at %s, found %s", acmePath, source)
+	}
+}
+
+// Test MakeCurrent links a file environment to its target
+func TestAppFileMakeCurrent(t *testing.T) {
+	setUpTest()
+	setUpFixtures(t)
+	wd, _ := os.Getwd()
+	current := path.Join(wd, "test/npmrc/current")
+	target := path.Join(wd, "fixtures/.npmrc")
+	os.Remove(current)
+	os.Remove(target)
+	defer os.Remove(current)
+	defer os.Remove(target)
+	a, _ := NewApp("npmrc", path.Join(wd, "test"))
+	if a.Target != target {
+		t.Errorf("Expected target to be %s, found %s", target, a.Target)
+	}
+	if template := path.Join(wd, "test/config/npmrc.template"); a.Template != template {
+		t.Errorf("Expected template to be %s, found %s", template, a.Template)
+	}
+	for _, envName := range []string{"acme", "dyncorp"} {
+		if err := a.MakeCurrent(envName); err != nil {
+			t.Fatalf("Expected switching to %s to succeed, received error %s", envName, err.Error())
+		}
+		expected := path.Join(wd, "test/npmrc", envName)
+		if source, _ := os.Readlink(target); source != expected {
+			t.Errorf("Expected target to link to %s, found %s", expected, source)
+		}
+		if e, _ := a.Current(); e == nil || e.EnvType != "file" || e.Path != expected {
+			t.Errorf("Expected current env to be file env at %s, found %v", expected, e)
+		}
+	}
+	a.Unlink()
+	if _, err := os.Lstat(target); err == nil {
+		t.Errorf("Expected unlink to remove target %s", target)
+	}
+}
+
+// Test MakeCurrent links every mapping of a directory environment
+func TestAppMappingsMakeCurrent(t *testing.T) {
+	setUpTest()
+	setUpFixtures(t)
+	wd, _ := os.Getwd()
+	current := path.Join(wd, "test/kube/current")
+	config := path.Join(wd, "fixtures/kube/config")
+	certs := path.Join(wd, "fixtures/certs")
+	os.Remove(current)
+	defer os.Remove(current)
+	defer os.RemoveAll(path.Join(wd, "fixtures/kube"))
+	defer os.Remove(certs)
+	a, _ := NewApp("kube", path.Join(wd, "test"))
+	if len(a.Mappings) != 2 {
+		t.Fatalf("Expected 2 mappings, found %v", a.Mappings)
+	}
+	if err := a.MakeCurrent("acme"); err != nil {
+		t.Fatalf("Expected switching to acme to succeed, received error %s", err.Error())
+	}
+	expected := map[string]string{config: path.Join(wd, "test/kube/acme/config"),
+		certs: path.Join(wd, "test/kube/acme/certs")}
+	for target, source := range expected {
+		if actual, _ := os.Readlink(target); actual != source {
+			t.Errorf("Expected %s to link to %s, found %s", target, source, actual)
+		}
+	}
+	// dyncorp has no certs, so nothing may change
+	if err := a.MakeCurrent("dyncorp"); err == nil {
+		t.Error("Expected error switching to env missing a mapped source but did not receive one")
+	}
+	for target, source := range expected {
+		if actual, _ := os.Readlink(target); actual != source {
+			t.Errorf("Expected %s to still link to %s, found %s", target, source, actual)
+		}
+	}
+	a.Unlink()
+	for target := range expected {
+		if _, err := os.Lstat(target); err == nil {
+			t.Errorf("Expected unlink to remove %s", target)
+		}
+	}
+}
+
+// Test Link removes the targets it linked when a later one fails
+func TestAppLinkIsAllOrNothing(t *testing.T) {
+	setUpTest()
+	setUpFixtures(t)
+	wd, _ := os.Getwd()
+	current := path.Join(wd, "test/kube/current")
+	config := path.Join(wd, "fixtures/kube/config")
+	os.Remove(current)
+	defer os.RemoveAll(path.Join(wd, "fixtures/kube"))
+	a, _ := NewApp("kube", path.Join(wd, "test"))
+	if err := a.Link("dyncorp"); err == nil {
+		t.Error("Expected error linking env missing a mapped source but did not receive one")
+	}
+	for _, link := range []string{current, config} {
+		if _, err := os.Lstat(link); err == nil {
+			t.Errorf("Expected %s to be removed after failed link", link)
+		}
 	}
 }
 
@@ -164,9 +325,11 @@ func TestAppMakeCurrent(t *testing.T) {
 
 func TestAppLoadAction(t *testing.T) {
 	setUpTest()
+	setUpFixtures(t)
 	wd, _ := os.Getwd()
 	output := path.Join(wd, "test/tmp/current")
 	os.Remove(output)
+	defer os.Remove(output)
 	a, _ := NewApp("ssh", path.Join(wd, "test"))
 	expected := path.Join(wd, "test/ssh/personal")
 	current := path.Join(wd, "test/ssh/current")
@@ -183,9 +346,11 @@ func TestAppLoadAction(t *testing.T) {
 
 func TestAppUnloadAction(t *testing.T) {
 	setUpTest()
+	setUpFixtures(t)
 	wd, _ := os.Getwd()
 	output := path.Join(wd, "test/tmp/current")
 	os.Remove(output)
+	defer os.Remove(output)
 	a, _ := NewApp("ssh", path.Join(wd, "test"))
 	expected := path.Join(wd, "test/ssh/personal")
 	current := path.Join(wd, "test/ssh/current")
@@ -202,6 +367,7 @@ func TestAppUnloadAction(t *testing.T) {
 
 func TestRunAction(t *testing.T) {
 	setUpTest()
+	setUpFixtures(t)
 	wd, _ := os.Getwd()
 	output := path.Join(wd, "test/tmp/load-test")
 	os.Remove(output)
@@ -219,6 +385,7 @@ func TestRunAction(t *testing.T) {
 
 func TestRunActionFails(t *testing.T) {
 	setUpTest()
+	setUpFixtures(t)
 	wd, _ := os.Getwd()
 	a, _ := NewApp("ssh", path.Join(wd, "test"))
 	a.LoadAction = "exit 1"
@@ -235,3 +402,57 @@ func relink(source string, link string) {
 	os.Remove(link)
 	os.Symlink(source, link)
 }
+
+// create an application in a fresh home whose load action fails for the
+// environment named broken
+func setUpRollbackApp(t *testing.T) *App {
+	home := t.TempDir()
+	definition := "type: directory\ntarget: " + path.Join(home, "target") + "\n" +
+		"load: test \"$(basename \"$SSW_CURRENT\")\" != broken\n" +
+		"unload: basename \"$SSW_CURRENT\" >> " + path.Join(home, "unloaded") + "\n"
+	addApp(t, home, "app", definition, map[string]string{"good/": "", "broken/": ""})
+	a, err := NewApp("app", home)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return a
+}
+
+func TestAppMakeCurrentRollsBack(t *testing.T) {
+	setUpTest()
+	a := setUpRollbackApp(t)
+	if err := a.MakeCurrent("good"); err != nil {
+		t.Fatalf("Expected switch to good to succeed, received error %s", err.Error())
+	}
+	err := a.MakeCurrent("broken")
+	rollbackErr, ok := err.(*RollbackError)
+	if !ok {
+		t.Fatalf("Expected RollbackError switching to broken, received %v", err)
+	}
+	if rollbackErr.RollbackErr != nil || rollbackErr.Previous != "good" {
+		t.Errorf("Expected rollback to good to succeed, found %s", rollbackErr.Error())
+	}
+	good := path.Join(a.Path, "good")
+	for _, link := range []string{path.Join(a.Path, "current"), a.Target} {
+		if source, _ := os.Readlink(link); source != good {
+			t.Errorf("Expected %s to point back at %s, found %s", link, good, source)
+		}
+	}
+	if d, _ := ioutil.ReadFile(path.Join(a.Home, "unloaded")); string(d) != "good\nbroken\n" {
+		t.Errorf("Expected broken to be unloaded before rolling back, found %q", d)
+	}
+}
+
+func TestAppMakeCurrentRollsBackToNothing(t *testing.T) {
+	setUpTest()
+	a := setUpRollbackApp(t)
+	err := a.MakeCurrent("broken")
+	if rollbackErr, ok := err.(*RollbackError); !ok || rollbackErr.RollbackErr != nil {
+		t.Fatalf("Expected successful rollback switching to broken, received %v", err)
+	}
+	for _, link := range []string{path.Join(a.Path, "current"), a.Target} {
+		if _, err := os.Lstat(link); err == nil {
+			t.Errorf("Expected %s to be removed by rollback", link)
+		}
+	}
+}
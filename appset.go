@@ -1,6 +1,7 @@
 package sellsword
 
 import (
+	"errors"
 	"fmt"
 	"github.com/fatih/color"
 	"io/ioutil"
@@ -22,35 +23,46 @@ func NewAppSet(home string) (*AppSet, error) {
 	return as, nil
 }
 
+// FindApps adds the applications appNames, or every application if the only name
+// is "all", to the AppSet. Applications whose definitions cannot be parsed are
+// left out and reported in the returned error
 func (as *AppSet) FindApps(appNames ...string) error {
 	if _, err := os.Stat(as.Home); os.IsNotExist(err) {
 		red := GetTermPrinterF(color.FgRed)
 		Logger.Errorln(red("The Home directory that you have specified, %s, does not exist.", as.Home))
-	} else {
-		if appNames[0] == "all" {
-			di, _ := ioutil.ReadDir(as.Home)
-			for i := range di {
-				if di[i].Name() != "config" {
-					name := strings.Split(di[i].Name(), ".ssw")[0]
-					a, _ := NewApp(name, as.Home)
-					as.Apps = append(as.Apps, a)
-				}
+		return err
+	}
+	if appNames[0] == "all" {
+		appNames = make([]string, 0)
+		di, _ := ioutil.ReadDir(as.Home)
+		for i := range di {
+			// dot directories hold sellsword's own state, such as sessions
+			if di[i].Name() != "config" && !strings.HasPrefix(di[i].Name(), ".") {
+				appNames = append(appNames, strings.Split(di[i].Name(), ".ssw")[0])
 			}
+		}
+	}
+	failures := make([]string, 0)
+	for i := range appNames {
+		if a, err := NewApp(appNames[i], as.Home); err != nil {
+			failures = append(failures, fmt.Sprintf("Application %s could not be loaded: %s", appNames[i], err.Error()))
 		} else {
-			for i := range appNames {
-				a, _ := NewApp(appNames[i], as.Home)
-				as.Apps = append(as.Apps, a)
-			}
+			as.Apps = append(as.Apps, a)
 		}
 	}
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "\n") +
+			"\nExecute `ssw app validate` to find the problems in application definitions")
+	}
 	return nil
 }
 
 func (as *AppSet) ListApps(appNames []string) {
 	if len(appNames) == 0 {
-		as.FindApps("all")
-	} else {
-		as.FindApps(appNames...)
+		appNames = []string{"all"}
+	}
+	if err := as.FindApps(appNames...); err != nil {
+		Logger.Errorln(err.Error())
 	}
 	for i := range as.Apps {
 		cyan := GetTermPrinter(color.FgCyan)
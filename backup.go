@@ -0,0 +1,164 @@
+package sellsword
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Targets that were in the way of a link are moved to a timestamped directory
+// under ~/.ssw/.backups/<app>/, along with a manifest of where they came from
+const backupManifest = "manifest.yml"
+
+func (a *App) backupsDir() string {
+	return path.Join(a.Home, ".backups", a.Name)
+}
+
+// isOwnLink reports whether target is a symlink into the application's
+// directory, i.e. one that sellsword created
+func (a *App) isOwnLink(target string) bool {
+	if source, err := resolveSymlink(target); err != nil {
+		return false
+	} else {
+		return strings.HasPrefix(source, a.Path+"/")
+	}
+}
+
+// clearTargets makes room for linking the application's targets. Links of our
+// own are left to be replaced while anything else is moved to a backup, but only
+// if the user agrees
+func (a *App) clearTargets() error {
+	foreign := make([]string, 0)
+	for _, m := range a.Mappings {
+		if _, err := os.Lstat(m.Target); os.IsNotExist(err) {
+			continue
+		}
+		if !a.isOwnLink(m.Target) {
+			foreign = append(foreign, m.Target)
+		}
+	}
+	if len(foreign) == 0 {
+		return nil
+	}
+	question := fmt.Sprintf("%s already exists and was not created by sellsword. Move it to %s?",
+		strings.Join(foreign, ", "), a.backupsDir())
+	if !Confirm(question) {
+		return errors.New(fmt.Sprintf("%s already exists and was not created by sellsword. "+
+			"Move it out of the way or rerun with --yes to back it up", strings.Join(foreign, ", ")))
+	}
+	return a.backup(foreign)
+}
+
+// backup moves targets into a new timestamped backup directory. If one cannot be
+// moved the targets already moved are put back and the directory is removed
+func (a *App) backup(targets []string) error {
+	dir := path.Join(a.backupsDir(), time.Now().Format("20060102-150405.000000000"))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	manifest := make(map[string]string)
+	for i := range targets {
+		name := fmt.Sprintf("%d-%s", i, path.Base(targets[i]))
+		if err := os.Rename(targets[i], path.Join(dir, name)); err != nil {
+			for done, target := range manifest {
+				if undoErr := os.Rename(path.Join(dir, done), target); undoErr != nil {
+					Logger.Errorf("Could not move %s back to %s: %s", path.Join(dir, done), target, undoErr.Error())
+				}
+			}
+			os.Remove(dir)
+			return err
+		}
+		manifest[name] = targets[i]
+		fmt.Fprintf(Out, "Moved %s to %s\n", targets[i], path.Join(dir, name))
+	}
+	if d, err := yaml.Marshal(manifest); err != nil {
+		return err
+	} else {
+		return ioutil.WriteFile(path.Join(dir, backupManifest), d, 0600)
+	}
+}
+
+// ListBackups returns the backup directories of the application, oldest first
+func (a *App) ListBackups() ([]string, error) {
+	backups := make([]string, 0)
+	di, err := ioutil.ReadDir(a.backupsDir())
+	if os.IsNotExist(err) {
+		return backups, nil
+	} else if err != nil {
+		return backups, err
+	}
+	for i := range di {
+		if di[i].IsDir() {
+			backups = append(backups, path.Join(a.backupsDir(), di[i].Name()))
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// Restore unlinks the current environment and puts back the targets moved away
+// by the most recent backup. Every target is checked before anything changes, and
+// if putting one back fails the targets already put back are moved to the backup again
+func (a *App) Restore() error {
+	unlock, err := a.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	backups, err := a.ListBackups()
+	if err != nil {
+		return err
+	} else if len(backups) == 0 {
+		return errors.New(fmt.Sprintf("There are no backups for application %s", a.Name))
+	}
+	dir := backups[len(backups)-1]
+	manifest := make(map[string]string)
+	if d, err := ioutil.ReadFile(path.Join(dir, backupManifest)); err != nil {
+		return err
+	} else if err := yaml.Unmarshal(d, manifest); err != nil {
+		return err
+	}
+	for name, target := range manifest {
+		if _, err := os.Lstat(path.Join(dir, name)); err != nil {
+			return err
+		}
+		// links of our own are removed by unlinking
+		if _, err := os.Lstat(target); err == nil && !a.isOwnLink(target) {
+			return errors.New(fmt.Sprintf("%s exists, refusing to overwrite it with the backup in %s",
+				target, dir))
+		}
+	}
+	if err := a.unlink(); err != nil {
+		return err
+	}
+	restored := make([]string, 0, len(manifest))
+	for name, target := range manifest {
+		if err := a.restoreTarget(path.Join(dir, name), target); err != nil {
+			for _, done := range restored {
+				if undoErr := os.Rename(manifest[done], path.Join(dir, done)); undoErr != nil {
+					Logger.Errorf("Could not move %s back to %s: %s", manifest[done], dir, undoErr.Error())
+				}
+			}
+			return err
+		}
+		restored = append(restored, name)
+		fmt.Fprintf(Out, "Restored %s\n", target)
+	}
+	return os.RemoveAll(dir)
+}
+
+func (a *App) restoreTarget(backup string, target string) error {
+	if _, err := os.Lstat(target); err == nil {
+		return errors.New(fmt.Sprintf("%s exists, refusing to overwrite it with the backup %s", target, backup))
+	}
+	if err := os.MkdirAll(path.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.Rename(backup, target)
+}
@@ -0,0 +1,136 @@
+package sellsword
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+// put a real directory where the chef app wants its target
+func setUpForeignTarget(t *testing.T, wd string) string {
+	target := path.Join(wd, "fixtures/.chef")
+	os.RemoveAll(target)
+	os.Remove(path.Join(wd, "test/chef/current"))
+	os.MkdirAll(target, 0755)
+	if err := ioutil.WriteFile(path.Join(target, "knife.rb"), []byte("original"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	return target
+}
+
+func TestLinkRefusesForeignTarget(t *testing.T) {
+	setUpTest()
+	setUpFixtures(t)
+	wd, _ := os.Getwd()
+	target := setUpForeignTarget(t, wd)
+	defer os.RemoveAll(target)
+	AssumeYes = false
+	a, _ := NewApp("chef", path.Join(wd, "test"))
+	if err := a.Link("acme"); err == nil {
+		t.Error("Expected error linking over a real directory but did not receive one")
+	}
+	if d, _ := ioutil.ReadFile(path.Join(target, "knife.rb")); string(d) != "original" {
+		t.Errorf("Expected %s to be left alone", target)
+	}
+}
+
+func TestLinkBacksUpAndRestores(t *testing.T) {
+	setUpTest()
+	setUpFixtures(t)
+	wd, _ := os.Getwd()
+	target := setUpForeignTarget(t, wd)
+	defer os.RemoveAll(target)
+	AssumeYes = true
+	defer func() { AssumeYes = false }()
+	a, _ := NewApp("chef", path.Join(wd, "test"))
+	defer os.RemoveAll(path.Join(a.Home, ".backups"))
+	if err := a.Link("acme"); err != nil {
+		t.Fatalf("Expected link to back up target, received error %s", err.Error())
+	}
+	if !a.isOwnLink(target) {
+		t.Errorf("Expected %s to be linked by sellsword", target)
+	}
+	if backups, _ := a.ListBackups(); len(backups) != 1 {
+		t.Errorf("Expected one backup, found %v", backups)
+	}
+	if err := a.Restore(); err != nil {
+		t.Fatalf("Expected restore to succeed, received error %s", err.Error())
+	}
+	if d, _ := ioutil.ReadFile(path.Join(target, "knife.rb")); string(d) != "original" {
+		t.Errorf("Expected original %s to be restored", target)
+	}
+	if _, err := os.Lstat(path.Join(wd, "test/chef/current")); err == nil {
+		t.Error("Expected restore to unlink the current environment")
+	}
+	if backups, _ := a.ListBackups(); len(backups) != 0 {
+		t.Errorf("Expected restored backup to be removed, found %v", backups)
+	}
+}
+
+func TestUnlinkLeavesForeignTarget(t *testing.T) {
+	setUpTest()
+	setUpFixtures(t)
+	wd, _ := os.Getwd()
+	target := setUpForeignTarget(t, wd)
+	defer os.RemoveAll(target)
+	relink(path.Join(wd, "test/chef/acme"), path.Join(wd, "test/chef/current"))
+	a, _ := NewApp("chef", path.Join(wd, "test"))
+	a.Unlink()
+	if d, _ := ioutil.ReadFile(path.Join(target, "knife.rb")); string(d) != "original" {
+		t.Errorf("Expected unlink not to remove %s", target)
+	}
+}
+
+func TestRestoreRefusesBeforeUnlinking(t *testing.T) {
+	setUpTest()
+	setUpFixtures(t)
+	wd, _ := os.Getwd()
+	target := setUpForeignTarget(t, wd)
+	defer os.RemoveAll(target)
+	AssumeYes = true
+	defer func() { AssumeYes = false }()
+	a, _ := NewApp("chef", path.Join(wd, "test"))
+	defer os.RemoveAll(path.Join(a.Home, ".backups"))
+	if err := a.Link("acme"); err != nil {
+		t.Fatalf("Expected link to back up target, received error %s", err.Error())
+	}
+	backups, _ := a.ListBackups()
+	// another file takes the place of one the backup would put back
+	manifest := path.Join(backups[0], backupManifest)
+	d, _ := ioutil.ReadFile(manifest)
+	blocked := path.Join(wd, "test/tmp/blocked")
+	defer os.Remove(blocked)
+	ioutil.WriteFile(blocked, []byte("in the way"), 0644)
+	ioutil.WriteFile(path.Join(backups[0], "1-blocked"), []byte("backed up"), 0644)
+	ioutil.WriteFile(manifest, append(d, []byte("1-blocked: "+blocked+"\n")...), 0600)
+	if err := a.Restore(); err == nil {
+		t.Fatal("Expected restore to refuse overwriting a file but did not receive an error")
+	}
+	if !a.isOwnLink(target) {
+		t.Errorf("Expected %s to stay linked when restore is refused", target)
+	}
+	if _, err := os.Stat(path.Join(backups[0], "0-.chef/knife.rb")); err != nil {
+		t.Errorf("Expected the backup to be left alone, found %v", err)
+	}
+}
+
+func TestBackupPutsTargetsBackOnFailure(t *testing.T) {
+	setUpTest()
+	setUpFixtures(t)
+	wd, _ := os.Getwd()
+	target := setUpForeignTarget(t, wd)
+	defer os.RemoveAll(target)
+	a, _ := NewApp("chef", path.Join(wd, "test"))
+	defer os.RemoveAll(path.Join(a.Home, ".backups"))
+	// the second target cannot be moved as it does not exist
+	if err := a.backup([]string{target, path.Join(wd, "fixtures/missing")}); err == nil {
+		t.Fatal("Expected error backing up a missing target but did not receive one")
+	}
+	if d, _ := ioutil.ReadFile(path.Join(target, "knife.rb")); string(d) != "original" {
+		t.Errorf("Expected %s to be moved back when the backup fails", target)
+	}
+	if backups, _ := a.ListBackups(); len(backups) != 0 {
+		t.Errorf("Expected no backup to be left, found %v", backups)
+	}
+}
@@ -1,26 +1,31 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/Sirupsen/logrus"
 	ssw "github.com/bryanwb/sellsword"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+	"io/ioutil"
 	"os"
 	"os/user"
 	"path"
+	"strings"
 )
 
 var log = logrus.New()
 
-func runShow(args []string, sswHome string) {
+func runShow(args []string, sswHome string, showValues bool) {
 	as, _ := ssw.NewAppSet(sswHome)
 	green := ssw.GetTermPrinter(color.FgGreen)
 	blue := ssw.GetTermPrinter(color.FgCyan)
 	if len(args) == 0 {
-		as.FindApps("all")
-	} else {
-		as.FindApps(args[0])
+		args = []string{"all"}
+	}
+	if err := as.FindApps(args[0]); err != nil {
+		log.Errorln(err.Error())
 	}
 	fmt.Println("Environments in use:")
 	for i := range as.Apps {
@@ -29,6 +34,24 @@ func runShow(args []string, sswHome string) {
 			fmt.Printf("%s\tno environment currently configured\n", green(as.Apps[i].Name))
 		} else {
 			fmt.Printf("%s\t%s\n", green(as.Apps[i].Name), blue(env.Name))
+			if showValues {
+				printValues(env)
+			}
+		}
+	}
+}
+
+// printValues lists the variables of an environment, masking secrets and naming
+// the environment inherited values come from
+func printValues(env *ssw.Env) {
+	for _, k := range env.VariableNames {
+		if _, ok := env.Variables[k]; !ok {
+			continue
+		}
+		if source := env.Source(k); source != env.Name {
+			fmt.Printf("  %s: %s\t(from %s)\n", k, env.DisplayValue(k), source)
+		} else {
+			fmt.Printf("  %s: %s\n", k, env.DisplayValue(k))
 		}
 	}
 }
@@ -36,37 +59,256 @@ func runShow(args []string, sswHome string) {
 func runLoad(args []string, sswHome string) {
 	as, _ := ssw.NewAppSet(sswHome)
 	if len(args) == 0 {
-		as.FindApps("all")
-	} else {
-		as.FindApps(args...)
+		args = []string{"all"}
+	}
+	if err := as.FindApps(args...); err != nil {
+		log.Errorln(err.Error())
 	}
+	failed := false
 	for i := range as.Apps {
-		as.Apps[i].Load()
+		if _, err := as.Apps[i].Current(); err != nil {
+			log.Debugf("Application %s has no current environment, nothing to load", as.Apps[i].Name)
+			continue
+		}
+		if err := as.Apps[i].Load(); err != nil {
+			log.Errorf("Could not load application %s: %s", as.Apps[i].Name, err.Error())
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
 	}
 }
 
-func runNewEnv(args []string, sswHome string, useNewEnv bool) {
+func runNewEnv(args []string, sswHome string, useNewEnv bool, setValues []string, fromFile string,
+	fromStdin bool) {
 	if len(args) > 2 || len(args) < 2 {
 		red := ssw.GetTermPrinter(color.FgRed)
 		fmt.Fprintf(os.Stderr, "%s\n", red("Usage: ssw new app_name env_name"))
 	} else {
 		appName := args[0]
 		envName := args[1]
-		as, _ := ssw.NewAppSet(sswHome)
-		if err := as.FindApps(appName); err != nil {
+		a := findApp(appName, sswHome)
+		values, err := readValues(setValues, fromFile, fromStdin)
+		if err != nil {
 			log.Errorln(err.Error())
-			log.Errorf("The application you have specified %s does not appear to be configured. "+
-				"Execute `ssw list` to see which applications are configured", appName)
-			os.Exit(0)
+			os.Exit(1)
 		}
-		a := as.Apps[0]
 		env, _ := a.NewEnv(envName)
-		if err := env.Construct(); err != nil {
+		if err := env.Construct(values); err != nil {
 			log.Error(err.Error())
-			os.Exit(0)
+			os.Exit(1)
+		}
+	}
+
+}
+
+// readValues gathers the values of variables from a file, stdin and key=value
+// arguments, in increasing order of precedence
+func readValues(setValues []string, fromFile string, fromStdin bool) (map[string]string, error) {
+	values := make(map[string]string)
+	sources := make([]func() ([]byte, error), 0)
+	if fromFile != "" {
+		sources = append(sources, func() ([]byte, error) { return ioutil.ReadFile(fromFile) })
+	}
+	if fromStdin {
+		sources = append(sources, func() ([]byte, error) { return ioutil.ReadAll(os.Stdin) })
+	}
+	for _, source := range sources {
+		d, err := source()
+		if err != nil {
+			return values, err
 		}
+		parsed, err := ssw.ParseValues(d)
+		if err != nil {
+			return values, err
+		}
+		for k, v := range parsed {
+			values[k] = v
+		}
+	}
+	overrides, err := ssw.ParseKeyValues(setValues)
+	if err != nil {
+		return values, err
 	}
+	for k, v := range overrides {
+		values[k] = v
+	}
+	return values, nil
+}
 
+func runValidate(appNames []string, sswHome string) {
+	if len(appNames) == 0 {
+		appNames = ssw.DefinedApps(sswHome)
+	}
+	green := ssw.GetTermPrinter(color.FgGreen)
+	red := ssw.GetTermPrinter(color.FgRed)
+	failed := false
+	for _, name := range appNames {
+		problems := ssw.ValidateDefinition(sswHome, name)
+		if len(problems) == 0 {
+			fmt.Printf("%s\t%s\n", green(name), "ok")
+			continue
+		}
+		failed = true
+		for i := range problems {
+			fmt.Println(red(problems[i].String()))
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func runDiff(args []string, sswHome string, options ssw.DiffOptions, asJson bool) {
+	app := findApp(args[0], sswHome)
+	changes, err := app.Diff(args[1], args[2], options)
+	if err != nil {
+		log.Errorln(err.Error())
+		os.Exit(1)
+	}
+	if asJson {
+		out, _ := json.MarshalIndent(map[string]interface{}{"app": app.Name, "from": args[1], "to": args[2],
+			"changes": changes}, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		printChanges(app, args[1], args[2], changes, options)
+	}
+	if len(changes) > 0 {
+		os.Exit(1)
+	}
+}
+
+func printChanges(app *ssw.App, from string, to string, changes []ssw.Change, options ssw.DiffOptions) {
+	green := ssw.GetTermPrinter(color.FgGreen)
+	red := ssw.GetTermPrinter(color.FgRed)
+	cyan := ssw.GetTermPrinter(color.FgCyan)
+	if app.EnvType == "environment" {
+		if len(changes) > 0 {
+			fmt.Printf("--- %s/%s\n+++ %s/%s\n", app.Name, from, app.Name, to)
+		}
+		for _, c := range changes {
+			if options.KeysOnly {
+				if c.Kind == "added" {
+					fmt.Println(green("+" + c.Key))
+				} else if c.Kind == "removed" {
+					fmt.Println(red("-" + c.Key))
+				} else {
+					fmt.Println(cyan("~" + c.Key))
+				}
+				continue
+			}
+			if c.Kind != "added" {
+				fmt.Println(red(fmt.Sprintf("-%s: %s", c.Key, c.Old)))
+			}
+			if c.Kind != "removed" {
+				fmt.Println(green(fmt.Sprintf("+%s: %s", c.Key, c.New)))
+			}
+		}
+		return
+	}
+	for _, c := range changes {
+		if c.Kind == "added" {
+			fmt.Printf("Only in %s: %s\n", to, c.Key)
+		} else if c.Kind == "removed" {
+			fmt.Printf("Only in %s: %s\n", from, c.Key)
+		} else if c.Diff != "" {
+			for _, line := range strings.Split(strings.TrimSuffix(c.Diff, "\n"), "\n") {
+				if strings.HasPrefix(line, "---") || strings.HasPrefix(line, "+++") {
+					fmt.Println(line)
+				} else if strings.HasPrefix(line, "@@") {
+					fmt.Println(cyan(line))
+				} else if strings.HasPrefix(line, "-") {
+					fmt.Println(red(line))
+				} else if strings.HasPrefix(line, "+") {
+					fmt.Println(green(line))
+				} else {
+					fmt.Println(line)
+				}
+			}
+		} else if c.Old != "" || c.New != "" {
+			fmt.Printf("%s: %s in %s, %s in %s\n", c.Key, c.Old, from, c.New, to)
+		} else {
+			fmt.Printf("Binary files %s and %s differ\n", path.Join(from, c.Key), path.Join(to, c.Key))
+		}
+	}
+}
+
+// findApp returns the application appName, exiting if it is not configured
+func findApp(appName string, sswHome string) *ssw.App {
+	as, _ := ssw.NewAppSet(sswHome)
+	if err := as.FindApps(appName); err != nil {
+		if _, statErr := os.Stat(path.Join(sswHome, "config", appName+".ssw")); os.IsNotExist(statErr) {
+			log.Errorf("The application you have specified %s does not appear to be configured. "+
+				"Execute `ssw list` to see which applications are configured", appName)
+		} else {
+			log.Errorln(err.Error())
+		}
+		os.Exit(1)
+	}
+	return as.Apps[0]
+}
+
+// stringsFlag collects every value of a flag that may be given more than once
+type stringsFlag []string
+
+func (f *stringsFlag) String() string { return strings.Join(*f, ",") }
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func (f *stringsFlag) Type() string { return "key=value" }
+
+// commandAfterDash returns the arguments following "--" on the command line,
+// which cobra does not tell us about
+func commandAfterDash() []string {
+	for i := range os.Args {
+		if os.Args[i] == "--" {
+			return os.Args[i+1:]
+		}
+	}
+	return []string{}
+}
+
+func runExec(args []string, sswHome string, clean bool) {
+	command := commandAfterDash()
+	if len(command) == 0 || len(args) == len(command) {
+		red := ssw.GetTermPrinter(color.FgRed)
+		fmt.Fprintf(os.Stderr, "%s\n", red("Usage: ssw exec app=env [app=env ...] -- command [arg ...]"))
+		os.Exit(1)
+	}
+	as, _ := ssw.NewAppSet(sswHome)
+	sels, err := as.Select(args[:len(args)-len(command)])
+	if err != nil {
+		log.Errorln(err.Error())
+		os.Exit(1)
+	}
+	status, err := ssw.Run(sels, clean, command[0], command[1:]...)
+	if err != nil {
+		log.Errorln(err.Error())
+	}
+	os.Exit(status)
+}
+
+func runShell(args []string, sswHome string, clean bool) {
+	if len(args) == 0 {
+		red := ssw.GetTermPrinter(color.FgRed)
+		fmt.Fprintf(os.Stderr, "%s\n", red("Usage: ssw shell app=env [app=env ...]"))
+		os.Exit(1)
+	}
+	as, _ := ssw.NewAppSet(sswHome)
+	sels, err := as.Select(args)
+	if err != nil {
+		log.Errorln(err.Error())
+		os.Exit(1)
+	}
+	status, err := ssw.RunShell(sels, clean)
+	if err != nil {
+		log.Errorln(err.Error())
+	}
+	os.Exit(status)
 }
 
 func mkdirP(directories []string) {
@@ -99,6 +341,7 @@ func main() {
 	log.Level = logrus.InfoLevel
 	ssw.Logger = log
 	var Verbose bool
+	var ShellName string
 	usr, _ := user.Current()
 	SswHome := path.Join(usr.HomeDir, "/.ssw")
 	var sswCmd = &cobra.Command{
@@ -111,16 +354,43 @@ func main() {
 	}
 	sswCmd.PersistentFlags().StringVarP(&SswHome, "ssw-home", "s", SswHome, "Home directory for Sellsword")
 	sswCmd.PersistentFlags().BoolVarP(&Verbose, "verbose", "v", false, "verbose output")
+	sswCmd.PersistentFlags().BoolVarP(&ssw.AssumeYes, "yes", "y", false,
+		"Answer yes to all questions, such as whether to back up existing targets")
+	sswCmd.PersistentFlags().StringVar(&ShellName, "shell", "",
+		"Shell dialect for exported variables, one of bash, zsh, fish or sh. Detected from $SHELL by default")
 
 	sswCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
 		if Verbose == true {
 			log.Level = logrus.DebugLevel
 		}
+		if cmd.Name() == "init" || cmd.Name() == "version" {
+			return
+		}
+		if ShellName == "" {
+			ssw.OutputShell = ssw.DetectShell()
+		} else if sh, err := ssw.NewShell(ShellName); err != nil {
+			log.Errorln(err.Error())
+			os.Exit(1)
+		} else {
+			ssw.OutputShell = sh
+		}
 		// Make sure home directory exists
 		if _, err := os.Stat(SswHome); os.IsNotExist(err) {
 			log.Errorf("The value set for SSW Home at %s does not exist", SswHome)
 			os.Exit(0)
 		}
+		// The ssw function passes a file for the statements it should evaluate. Without
+		// it statements go to stdout, so everything else has to go to stderr
+		if evalFile := os.Getenv("SSW_EVAL_FILE"); evalFile != "" {
+			if f, err := os.OpenFile(evalFile, os.O_WRONLY|os.O_APPEND, 0600); err != nil {
+				log.Errorln(err.Error())
+				os.Exit(1)
+			} else {
+				ssw.EvalOut = f
+			}
+		} else {
+			ssw.Out = os.Stderr
+		}
 	}
 
 	var versionCmd = &cobra.Command{
@@ -133,19 +403,31 @@ func main() {
 	}
 	sswCmd.AddCommand(versionCmd)
 
-	// var initCmd = &cobra.Command{
-	// 	Use:   "init",
-	// 	Short: "Initialize Sellsword",
-	// 	Long:  `This command creates the Sellsword directory structure and downloads default configurations from git@github.com:bryanwb/sellsword.git`,
-	// 	Run: func(cmd *cobra.Command, args []string) {
-	// 		usr, _ := user.Current()
-	// 		homedir := path.Join(usr.HomeDir, ".ssw/config")
-	// 		awsdir := path.Join(usr.HomeDir, ".ssw/aws")
-	// 		chefdir := path.Join(usr.HomeDir, ".ssw/chef")
-	// 		mkdirP([]string{homedir, awsdir, chefdir})
-	// 	},
-	// }
-	// sswCmd.AddCommand(initCmd)
+	var sessionMode bool
+	var initCmd = &cobra.Command{
+		Use:   "init shell",
+		Short: "Print the ssw shell function",
+		Long: `Print the ssw shell function for bash, zsh, fish or sh. Add the following to your rc file:
+
+    eval "$(sellsword init bash)"     # bash, zsh or sh
+    sellsword init fish | source      # fish`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 {
+				red := ssw.GetTermPrinter(color.FgRed)
+				fmt.Fprintf(os.Stderr, "%s\n", red("Usage: sellsword init shell"))
+				os.Exit(1)
+			}
+			if sh, err := ssw.NewShell(args[0]); err != nil {
+				log.Errorln(err.Error())
+				os.Exit(1)
+			} else {
+				fmt.Print(sh.Hook(sessionMode))
+			}
+		},
+	}
+	initCmd.Flags().BoolVar(&sessionMode, "session", false,
+		"Scope the environments selected with use to each terminal")
+	sswCmd.AddCommand(initCmd)
 
 	var loadCmd = &cobra.Command{
 		Use:   "load",
@@ -157,14 +439,17 @@ func main() {
 	}
 	sswCmd.AddCommand(loadCmd)
 
+	var showValues bool
 	var showCmd = &cobra.Command{
 		Use:   "show",
 		Short: "Show Sellsword environments",
-		Long:  `Show current Sellsword environments`,
+		Long: `Show current Sellsword environments. With --values, also show the variables of
+environments, secrets masked, and which environment inherited values come from`,
 		Run: func(cmd *cobra.Command, args []string) {
-			runShow(args, SswHome)
+			runShow(args, SswHome, showValues)
 		},
 	}
+	showCmd.Flags().BoolVar(&showValues, "values", false, "Show the values of variables and where they come from")
 	sswCmd.AddCommand(showCmd)
 
 	var listCmd = &cobra.Command{
@@ -178,6 +463,7 @@ func main() {
 	}
 	sswCmd.AddCommand(listCmd)
 
+	var useGlobal bool
 	var useCmd = &cobra.Command{
 		Use:   "use app env",
 		Short: "Load environment and set it as default for application",
@@ -189,15 +475,31 @@ func main() {
 				fmt.Fprintf(os.Stderr, "%s\n",
 					red("Execute `ssw list` to show available applications and environments"))
 			} else {
-				as, _ := ssw.NewAppSet(SswHome)
-				appName := args[0]
 				envName := args[1]
-				as.FindApps(appName)
-				app := as.Apps[0]
-				app.MakeCurrent(envName)
+				app := findApp(args[0], SswHome)
+				if app.Session != "" && !useGlobal && app.EnvType == "environment" {
+					if _, err := ssw.CollectSessions(SswHome); err != nil {
+						log.Warnln(err.Error())
+					}
+					if err := app.MakeSessionCurrent(envName); err != nil {
+						log.Errorln(err.Error())
+						os.Exit(1)
+					}
+				} else {
+					if app.Session != "" && !useGlobal {
+						log.Warnf("Application %s of type %s cannot be scoped to a session, switching globally",
+							app.Name, app.EnvType)
+					}
+					if err := app.MakeCurrent(envName); err != nil {
+						log.Errorln(err.Error())
+						os.Exit(1)
+					}
+				}
 			}
 		},
 	}
+	useCmd.Flags().BoolVarP(&useGlobal, "global", "g", false,
+		"Set the default environment for all terminals, even in session mode")
 	sswCmd.AddCommand(useCmd)
 
 	var unlinkCmd = &cobra.Command{
@@ -210,28 +512,367 @@ leaving no environment currently configured for an application`,
 				red := ssw.GetTermPrinter(color.FgRed)
 				fmt.Fprintf(os.Stderr, "%s\n", red("Usage: ssw unlink app_name"))
 			} else {
-				as, _ := ssw.NewAppSet(SswHome)
-				appName := args[0]
-				as.FindApps(appName)
-				app := as.Apps[0]
-				app.Unlink()
+				app := findApp(args[0], SswHome)
+				if err := app.Unload(); err != nil {
+					log.Errorln(err.Error())
+				}
+				if app.Session != "" && !useGlobal {
+					// drop only this terminal's selection and load the global one
+					if err := app.UnlinkSession(); err != nil {
+						log.Errorln(err.Error())
+						os.Exit(1)
+					}
+					if _, err := app.Current(); err == nil {
+						if err := app.Load(); err != nil {
+							log.Errorf("Could not load application %s: %s", app.Name, err.Error())
+							os.Exit(1)
+						}
+					}
+				} else if err := app.Unlink(); err != nil {
+					log.Errorln(err.Error())
+					os.Exit(1)
+				}
 			}
 		},
 	}
+	unlinkCmd.Flags().BoolVarP(&useGlobal, "global", "g", false,
+		"Unlink the default environment for all terminals, even in session mode")
 	sswCmd.AddCommand(unlinkCmd)
 
+	var restoreCmd = &cobra.Command{
+		Use:   "restore app",
+		Short: "Restore the files sellsword backed up for an application",
+		Long: `Unlink the current environment of an application and put back the files that
+were moved to ~/.ssw/.backups/<app>/ to make room for its targets`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 {
+				red := ssw.GetTermPrinter(color.FgRed)
+				fmt.Fprintf(os.Stderr, "%s\n", red("Usage: ssw restore app_name"))
+				os.Exit(1)
+			}
+			app := findApp(args[0], SswHome)
+			if _, err := app.Current(); err == nil {
+				if err := app.Unload(); err != nil {
+					log.Errorln(err.Error())
+				}
+			}
+			if err := app.Restore(); err != nil {
+				log.Errorln(err.Error())
+				os.Exit(1)
+			}
+		},
+	}
+	sswCmd.AddCommand(restoreCmd)
+
+	var setValues stringsFlag
+	var cpCmd = &cobra.Command{
+		Use:   "cp app src dst",
+		Short: "Copy an environment",
+		Long: `Create the environment dst as a copy of src. For applications of type environment,
+--set=key=value changes a variable of the copy and can be given more than once`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 3 {
+				red := ssw.GetTermPrinter(color.FgRed)
+				fmt.Fprintf(os.Stderr, "%s\n", red("Usage: ssw cp app_name source_env new_env [--set=key=value ...]"))
+				os.Exit(1)
+			}
+			overrides, err := ssw.ParseKeyValues(setValues)
+			if err != nil {
+				log.Errorln(err.Error())
+				os.Exit(1)
+			}
+			app := findApp(args[0], SswHome)
+			if err := app.Copy(args[1], args[2], overrides); err != nil {
+				log.Errorln(err.Error())
+				os.Exit(1)
+			}
+		},
+	}
+	cpCmd.Flags().Var(&setValues, "set", "Set a variable of the copy, as --set=key=value")
+	sswCmd.AddCommand(cpCmd)
+
+	var mvCmd = &cobra.Command{
+		Use:   "mv app src dst",
+		Short: "Rename an environment",
+		Long: `Rename the environment src to dst. If src is in use, the current environment
+and the targets of the application are pointed at dst`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 3 {
+				red := ssw.GetTermPrinter(color.FgRed)
+				fmt.Fprintf(os.Stderr, "%s\n", red("Usage: ssw mv app_name env new_name"))
+				os.Exit(1)
+			}
+			app := findApp(args[0], SswHome)
+			if err := app.Move(args[1], args[2]); err != nil {
+				log.Errorln(err.Error())
+				os.Exit(1)
+			}
+		},
+	}
+	sswCmd.AddCommand(mvCmd)
+
+	var getCmd = &cobra.Command{
+		Use:   "get app [env] key",
+		Short: "Print the value of a variable",
+		Long: `Print the raw value of a variable, given by its name or the name of an environment
+variable, in an environment or by default in the current one`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 2 && len(args) != 3 {
+				red := ssw.GetTermPrinter(color.FgRed)
+				fmt.Fprintf(os.Stderr, "%s\n", red("Usage: ssw get app_name [environment] key"))
+				os.Exit(1)
+			}
+			envName := ""
+			if len(args) == 3 {
+				envName = args[1]
+			}
+			if value, err := findApp(args[0], SswHome).Get(envName, args[len(args)-1]); err != nil {
+				log.Errorln(err.Error())
+				os.Exit(1)
+			} else {
+				fmt.Println(value)
+			}
+		},
+	}
+	sswCmd.AddCommand(getCmd)
+
+	var setCmd = &cobra.Command{
+		Use:   "set app env key=value ...",
+		Short: "Change variables of an environment",
+		Long: `Change variables of an environment. The environment is only saved if it still
+satisfies the application definition. If it is the current environment, its
+variables are exported again`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 3 {
+				red := ssw.GetTermPrinter(color.FgRed)
+				fmt.Fprintf(os.Stderr, "%s\n", red("Usage: ssw set app_name environment key=value [key=value ...]"))
+				os.Exit(1)
+			}
+			values, err := ssw.ParseKeyValues(args[2:])
+			if err != nil {
+				log.Errorln(err.Error())
+				os.Exit(1)
+			}
+			if err := findApp(args[0], SswHome).Set(args[1], values); err != nil {
+				log.Errorln(err.Error())
+				os.Exit(1)
+			}
+		},
+	}
+	sswCmd.AddCommand(setCmd)
+
+	var editCmd = &cobra.Command{
+		Use:   "edit app env",
+		Short: "Edit an environment in $EDITOR",
+		Long: `Open an environment in $EDITOR. Changes are only saved if the environment still
+satisfies the application definition. If it is the current environment, its
+variables are exported again`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 2 {
+				red := ssw.GetTermPrinter(color.FgRed)
+				fmt.Fprintf(os.Stderr, "%s\n", red("Usage: ssw edit app_name environment"))
+				os.Exit(1)
+			}
+			if err := findApp(args[0], SswHome).Edit(args[1]); err != nil {
+				log.Errorln(err.Error())
+				os.Exit(1)
+			}
+		},
+	}
+	sswCmd.AddCommand(editCmd)
+
+	var diffOptions ssw.DiffOptions
+	var diffJson bool
+	var diffCmd = &cobra.Command{
+		Use:   "diff app env1 env2",
+		Short: "Compare two environments",
+		Long: `Compare two environments of an application. Environments of applications of type
+environment are compared variable by variable, with secrets masked unless
+--show-secrets is given, the others file by file. Exits with 1 if they differ`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 3 {
+				red := ssw.GetTermPrinter(color.FgRed)
+				fmt.Fprintf(os.Stderr, "%s\n", red("Usage: ssw diff app_name env1 env2 [--keys] [--show-secrets] [--json]"))
+				os.Exit(1)
+			}
+			runDiff(args, SswHome, diffOptions, diffJson)
+		},
+	}
+	diffCmd.Flags().BoolVar(&diffOptions.KeysOnly, "keys", false, "Only compare which variables are set")
+	diffCmd.Flags().BoolVar(&diffOptions.ShowSecrets, "show-secrets", false, "Show the values of secrets")
+	diffCmd.Flags().BoolVar(&diffJson, "json", false, "Print the differences as JSON")
+	sswCmd.AddCommand(diffCmd)
+
+	var appCmd = &cobra.Command{
+		Use:   "app validate [app ...]",
+		Short: "Check application definitions",
+		Long: `Check the definitions of the given applications, or of every application, and
+report each problem with its file and line. Exits with status 1 if there are any`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 1 || args[0] != "validate" {
+				red := ssw.GetTermPrinter(color.FgRed)
+				fmt.Fprintf(os.Stderr, "%s\n", red("Usage: ssw app validate [app_name ...]"))
+				os.Exit(1)
+			}
+			runValidate(args[1:], SswHome)
+		},
+	}
+	sswCmd.AddCommand(appCmd)
+
+	var forceRemove bool
+	var rmCmd = &cobra.Command{
+		Use:   "rm app env",
+		Short: "Move an environment to the trash",
+		Long: `Move an environment of an application to ~/.ssw/.trash/<app>/, from where
+ssw trash restore can bring it back. The current environment is only removed
+with --force, which unloads and unlinks it first`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 2 {
+				red := ssw.GetTermPrinter(color.FgRed)
+				fmt.Fprintf(os.Stderr, "%s\n", red("Usage: ssw rm app_name environment"))
+				os.Exit(1)
+			}
+			if _, err := findApp(args[0], SswHome).Remove(args[1], forceRemove); err != nil {
+				log.Errorln(err.Error())
+				os.Exit(1)
+			}
+		},
+	}
+	rmCmd.Flags().BoolVarP(&forceRemove, "force", "f", false,
+		"Remove the environment even if it is the current one")
+	sswCmd.AddCommand(rmCmd)
+
+	var trashCmd = &cobra.Command{
+		Use:   "trash list|restore|purge",
+		Short: "Manage removed environments",
+		Long: `Manage the environments removed with ssw rm.
+
+    ssw trash list [app ...]        # list removed environments
+    ssw trash restore app env       # put back the latest removed version of env
+    ssw trash purge [app ...]       # delete removed environments for good`,
+		Run: func(cmd *cobra.Command, args []string) {
+			red := ssw.GetTermPrinter(color.FgRed)
+			if len(args) < 1 {
+				fmt.Fprintf(os.Stderr, "%s\n", red("Usage: ssw trash list|restore|purge"))
+				os.Exit(1)
+			}
+			switch args[0] {
+			case "list":
+				items, err := ssw.ListTrash(SswHome, args[1:]...)
+				if err != nil {
+					log.Errorln(err.Error())
+					os.Exit(1)
+				}
+				green := ssw.GetTermPrinter(color.FgGreen)
+				blue := ssw.GetTermPrinter(color.FgCyan)
+				for i := range items {
+					fmt.Printf("%s\t%s\t%s\n", green(items[i].App), blue(items[i].Env),
+						items[i].Removed.Format("2006-01-02 15:04:05"))
+				}
+			case "restore":
+				if len(args) != 3 {
+					fmt.Fprintf(os.Stderr, "%s\n", red("Usage: ssw trash restore app_name environment"))
+					os.Exit(1)
+				}
+				if err := ssw.RestoreTrash(SswHome, args[1], args[2]); err != nil {
+					log.Errorln(err.Error())
+					os.Exit(1)
+				}
+			case "purge":
+				if !ssw.Confirm("Delete the removed environments for good?") {
+					log.Warnln("Not purging the trash, use --yes to purge without asking")
+					os.Exit(1)
+				}
+				if purged, err := ssw.PurgeTrash(SswHome, args[1:]...); err != nil {
+					log.Errorln(err.Error())
+					os.Exit(1)
+				} else {
+					for i := range purged {
+						fmt.Printf("Purged %s environment %s\n", purged[i].App, purged[i].Env)
+					}
+				}
+			default:
+				fmt.Fprintf(os.Stderr, "%s\n", red("Usage: ssw trash list|restore|purge"))
+				os.Exit(1)
+			}
+		},
+	}
+	sswCmd.AddCommand(trashCmd)
+
+	var sessionCmd = &cobra.Command{
+		Use:   "session gc",
+		Short: "Manage per-terminal sessions",
+		Long: `Manage the per-terminal sessions enabled with sellsword init --session.
+gc removes the sessions of terminals that are no longer running`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 || args[0] != "gc" {
+				red := ssw.GetTermPrinter(color.FgRed)
+				fmt.Fprintf(os.Stderr, "%s\n", red("Usage: ssw session gc"))
+				os.Exit(1)
+			}
+			if removed, err := ssw.CollectSessions(SswHome); err != nil {
+				log.Errorln(err.Error())
+				os.Exit(1)
+			} else {
+				for i := range removed {
+					fmt.Printf("Removed session %s\n", removed[i])
+				}
+			}
+		},
+	}
+	sswCmd.AddCommand(sessionCmd)
+
+	var cleanEnv bool
+	var execCmd = &cobra.Command{
+		Use:   "exec app=env ... -- command [arg ...]",
+		Short: "Run a command with environments without switching to them",
+		Long: `Run a command with the environments of one or more applications without changing
+the current environment of any application`,
+		Run: func(cmd *cobra.Command, args []string) {
+			runExec(args, SswHome, cleanEnv)
+		},
+	}
+	execCmd.Flags().BoolVarP(&cleanEnv, "clean", "c", false,
+		"Start from a scrubbed environment instead of the current one")
+	sswCmd.AddCommand(execCmd)
+
+	var shellCmd = &cobra.Command{
+		Use:   "shell app=env ...",
+		Short: "Start a subshell with environments without switching to them",
+		Long: `Start $SHELL with the environments of one or more applications without changing
+the current environment of any application. SSW_SHELL_ENVS lists the environments
+in use so that your prompt can show them`,
+		Run: func(cmd *cobra.Command, args []string) {
+			runShell(args, SswHome, cleanEnv)
+		},
+	}
+	shellCmd.Flags().BoolVarP(&cleanEnv, "clean", "c", false,
+		"Start from a scrubbed environment instead of the current one")
+	sswCmd.AddCommand(shellCmd)
+
 	var useNewEnv bool
+	var newValues stringsFlag
+	var fromFile string
+	var fromStdin bool
 	var newCmd = &cobra.Command{
 		Use:   "new app env_name",
 		Short: "Create a new environment for an application",
-		Long:  `Create a new environment for an application`,
+		Long: `Create a new environment for an application. Values for the variables of an
+environment can be given with --set=key=value, --from-file and --from-stdin, as YAML
+or as KEY=value lines. You are asked for the rest, which fails if stdin is not a terminal`,
 		Run: func(cmd *cobra.Command, args []string) {
-			runNewEnv(args, SswHome, useNewEnv)
+			runNewEnv(args, SswHome, useNewEnv, newValues, fromFile, fromStdin)
 		},
 	}
 	newCmd.Flags().BoolVarP(&useNewEnv, "use", "u", false, "Use new environment")
+	newCmd.Flags().Var(&newValues, "set", "Set a variable, as --set=key=value")
+	newCmd.Flags().StringVar(&fromFile, "from-file", "", "Read variables from a YAML or dotenv file")
+	newCmd.Flags().BoolVar(&fromStdin, "from-stdin", false, "Read variables as YAML or dotenv from stdin")
 	sswCmd.AddCommand(newCmd)
 
-	sswCmd.Execute()
+	// cobra reports bad flags and unknown commands but leaves the exit status to us
+	if err := sswCmd.Execute(); err != nil && err != flag.ErrHelp {
+		os.Exit(1)
+	}
 
 }
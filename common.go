@@ -1,10 +1,13 @@
 package sellsword
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	log "github.com/Sirupsen/logrus"
 	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+	"io"
 	"os"
 	"os/user"
 	"path"
@@ -16,6 +19,15 @@ var Logger *log.Logger
 
 var Version = "0.0.3"
 
+// EvalOut receives the statements that the ssw function evaluates in the parent shell
+var EvalOut io.Writer = os.Stdout
+
+// Out receives messages for the user, which must never end up in EvalOut
+var Out io.Writer = os.Stdout
+
+// AssumeYes answers yes to every confirmation, for non-interactive use
+var AssumeYes bool
+
 func GetTermPrinter(colorName color.Attribute) func(...interface{}) string {
 	newColor := color.New(colorName)
 	newColor.EnableColor()
@@ -81,3 +93,35 @@ func arrayToEmptyMap(a []string) map[string]string {
 	}
 	return m
 }
+
+// Confirm asks the user a yes or no question, answering no when stdin is not a
+// terminal unless AssumeYes is set
+func Confirm(question string) bool {
+	if AssumeYes {
+		return true
+	}
+	if !isatty.IsTerminal(os.Stdin.Fd()) {
+		return false
+	}
+	fmt.Fprintf(Out, "%s [y/N] ", question)
+	reader := bufio.NewReader(os.Stdin)
+	if text, err := reader.ReadString('\n'); err != nil {
+		return false
+	} else {
+		answer := strings.ToLower(strings.TrimSpace(text))
+		return answer == "y" || answer == "yes"
+	}
+}
+
+// ParseKeyValues turns arguments of the form key=value into a map
+func ParseKeyValues(pairs []string) (map[string]string, error) {
+	values := make(map[string]string, len(pairs))
+	for i := range pairs {
+		keyValue := strings.SplitN(pairs[i], "=", 2)
+		if len(keyValue) != 2 || strings.TrimSpace(keyValue[0]) == "" {
+			return values, errors.New(fmt.Sprintf("%s is not of the form key=value", pairs[i]))
+		}
+		values[strings.TrimSpace(keyValue[0])] = keyValue[1]
+	}
+	return values, nil
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/user"
 	"path"
+	"strings"
 	"testing"
 )
 
@@ -23,8 +24,62 @@ func setUpTest() string {
 	return tmpdir
 }
 
+// setUpFixtures makes the fixtures directory, where the applications under test/
+// put their targets, and removes it when the test finishes
+func setUpFixtures(t *testing.T) {
+	wd, _ := os.Getwd()
+	fixtures := path.Join(wd, "fixtures")
+	if err := os.MkdirAll(fixtures, 0755); err != nil {
+		t.Fatal(err.Error())
+	}
+	t.Cleanup(func() { os.RemoveAll(fixtures) })
+}
+
+// setUpHome makes a sellsword home in a temporary directory that is removed when
+// the test finishes, with the definition of app and its environment files
+func setUpHome(t *testing.T, app string, definition string, envs map[string]string) string {
+	home := t.TempDir()
+	addApp(t, home, app, definition, envs)
+	return home
+}
+
+// addApp writes the definition of app to home along with its environment files,
+// keyed by their paths under the directory of app. Paths ending in / are made as
+// directories
+func addApp(t *testing.T, home string, app string, definition string, envs map[string]string) {
+	if err := os.MkdirAll(path.Join(home, "config"), 0755); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := ioutil.WriteFile(path.Join(home, "config", app+".ssw"), []byte(definition), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := os.MkdirAll(path.Join(home, app), 0755); err != nil {
+		t.Fatal(err.Error())
+	}
+	for name, contents := range envs {
+		file := path.Join(home, app, name)
+		if strings.HasSuffix(name, "/") {
+			os.MkdirAll(file, 0755)
+		} else if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+			t.Fatal(err.Error())
+		} else if err := ioutil.WriteFile(file, []byte(contents), 0644); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+}
+
+// setUpApp loads app from a home made by setUpHome
+func setUpApp(t *testing.T, app string, definition string, envs map[string]string) *App {
+	a, err := NewApp(app, setUpHome(t, app, definition, envs))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return a
+}
+
 func TestResolveSymlinkForRealLink(t *testing.T) {
-	tmpdir := setUpTest()
+	setUpTest()
+	tmpdir := t.TempDir()
 	source := path.Join(tmpdir, "source")
 	target := path.Join(tmpdir, "target")
 	ioutil.WriteFile(source, []byte{}, 0755)
@@ -0,0 +1,224 @@
+package sellsword
+
+import (
+	"errors"
+	"fmt"
+	"github.com/fatih/color"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// checkNewEnvName reports an error unless envName is free to be used for a new
+// environment of the application
+func (a *App) checkNewEnvName(envName string) error {
+	if envName == "" || envName == "current" || strings.HasPrefix(envName, ".") || strings.Contains(envName, "/") {
+		return errors.New(fmt.Sprintf("%s is not a valid environment name", envName))
+	}
+	if _, err := os.Lstat(path.Join(a.Path, envName)); err == nil {
+		return errors.New(fmt.Sprintf("Environment %s already exists for application %s", envName, a.Name))
+	}
+	return nil
+}
+
+// checkEnvExists reports an error unless envName is an environment of the application
+func (a *App) checkEnvExists(envName string) error {
+	if envName == "current" || strings.HasPrefix(envName, ".") {
+		return errors.New(fmt.Sprintf("%s is not a valid environment name", envName))
+	}
+	if _, err := os.Stat(path.Join(a.Path, envName)); err != nil {
+		return errors.New(fmt.Sprintf("Environment %s does not exist for application %s", envName, a.Name))
+	}
+	return nil
+}
+
+// Copy creates the environment dst as a copy of src. The variables of an
+// environment-type application can be changed on the way with overrides, the
+// environments of other types are copied as they are
+func (a *App) Copy(src string, dst string, overrides map[string]string) error {
+	unlock, err := a.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := a.checkEnvExists(src); err != nil {
+		return err
+	}
+	if err := a.checkNewEnvName(dst); err != nil {
+		return err
+	}
+	if a.EnvType != "environment" {
+		if len(overrides) > 0 {
+			return errors.New(fmt.Sprintf("Variables can only be set when copying environments of "+
+				"applications of type environment, %s is of type %s", a.Name, a.EnvType))
+		}
+		return copyPath(path.Join(a.Path, src), path.Join(a.Path, dst))
+	}
+	srcEnv, err := a.NewEnv(src)
+	if err != nil {
+		return err
+	}
+	dstEnv, err := a.NewEnv(dst)
+	if err != nil {
+		return err
+	}
+	// the copy extends what the source extends and sets what the source sets
+	dstEnv.Extends, dstEnv.inherited, dstEnv.layout = srcEnv.Extends, srcEnv.inherited, srcEnv.layout
+	dstEnv.Variables = make(map[string]string, len(srcEnv.Variables))
+	dstEnv.Sources = make(map[string]string, len(srcEnv.Variables))
+	for k, v := range srcEnv.Variables {
+		dstEnv.Variables[k] = v
+		if source := srcEnv.Source(k); source == src {
+			dstEnv.Sources[k] = dst
+		} else {
+			dstEnv.Sources[k] = source
+		}
+	}
+	resolved, err := dstEnv.resolveValues(overrides)
+	if err != nil {
+		return err
+	}
+	for k, v := range resolved {
+		dstEnv.Variables[k] = v
+		dstEnv.Sources[k] = dst
+	}
+	if err := dstEnv.Validate(); err != nil {
+		return err
+	}
+	if err := dstEnv.Save(); err != nil {
+		return err
+	}
+	green := GetTermPrinterF(color.FgGreen)
+	fmt.Fprint(Out, green("New environment created at %s\n", dstEnv.Path))
+	return nil
+}
+
+// copyPath copies the file or directory src to dst, keeping modes and
+// recreating symlinks rather than following them
+func copyPath(src string, dst string) error {
+	fi, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSymlink == os.ModeSymlink {
+		if source, err := os.Readlink(src); err != nil {
+			return err
+		} else {
+			return os.Symlink(source, dst)
+		}
+	} else if fi.IsDir() {
+		if err := os.Mkdir(dst, fi.Mode().Perm()); err != nil {
+			return err
+		}
+		di, err := ioutil.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for i := range di {
+			if err := copyPath(path.Join(src, di[i].Name()), path.Join(dst, di[i].Name())); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Move renames the environment src to dst. If src is in use, the current
+// symlink, the symlinks of every session and the targets are pointed at dst, and
+// environments that extend src are changed to extend dst. If any step fails, the
+// steps already taken are undone and a *RollbackError is returned
+func (a *App) Move(src string, dst string) error {
+	if err := a.checkEnvExists(src); err != nil {
+		return err
+	}
+	if err := a.checkNewEnvName(dst); err != nil {
+		return err
+	}
+	unlock, err := a.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	// loaded before the rename, while their parent can still be found
+	children := a.extendedBy(src)
+	srcPath, dstPath := path.Join(a.Path, src), path.Join(a.Path, dst)
+	if err := os.Rename(srcPath, dstPath); err != nil {
+		return err
+	}
+	undo := []func() error{func() error { return os.Rename(dstPath, srcPath) }}
+	rollback := func(err error) error {
+		return &RollbackError{Err: err, RollbackErr: undoSteps(undo), Previous: src}
+	}
+	links := []string{}
+	if di, err := ioutil.ReadDir(sessionsDir(a.Home)); err == nil {
+		for i := range di {
+			links = append(links, path.Join(sessionsDir(a.Home), di[i].Name(), a.Name))
+		}
+	}
+	current := path.Join(a.Path, "current")
+	if linksTo(current, src) {
+		for _, m := range a.Mappings {
+			Logger.Debugf("Pointing %s at %s", m.Target, dstPath)
+			if err := m.link(dstPath); err != nil {
+				return rollback(err)
+			}
+			source, target := path.Join(srcPath, m.Source), m.Target
+			undo = append(undo, func() error { return replaceSymlink(source, target) })
+		}
+		// current last, as in Link
+		links = append(links, current)
+	}
+	for i := range links {
+		if linksTo(links[i], src) {
+			if err := replaceSymlink(dstPath, links[i]); err != nil {
+				return rollback(err)
+			}
+			link := links[i]
+			undo = append(undo, func() error { return replaceSymlink(srcPath, link) })
+		}
+	}
+	for _, child := range children {
+		Logger.Debugf("Pointing environment %s at %s", child.Name, dst)
+		original, err := child.setExtends(dst)
+		if err != nil {
+			return rollback(err)
+		}
+		file := child.Path
+		undo = append(undo, func() error {
+			fi, err := os.Stat(file)
+			if err != nil {
+				return err
+			}
+			return replaceFile(file, original, fi.Mode().Perm())
+		})
+	}
+	return nil
+}
+
+// undoSteps undoes the steps taken so far, last first, and returns the first
+// error. The caller must hold the lock
+func undoSteps(steps []func() error) error {
+	var first error
+	for i := len(steps) - 1; i >= 0; i-- {
+		if err := steps[i](); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
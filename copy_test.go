@@ -0,0 +1,88 @@
+package sellsword
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+// setUpCopyHome makes a home with the environment application aws and the
+// directory application chef, whose acme environment holds a key and a link to it
+func setUpCopyHome(t *testing.T) string {
+	home := setUpHome(t, "aws", "type: environment\nvariables:\n  - region=AWS_REGION\n  - username=AWS_USER\n",
+		map[string]string{"dev": "region: us-east-1\nusername: dev\n"})
+	addApp(t, home, "chef", "type: directory\ntarget: "+path.Join(home, "target")+"\n",
+		map[string]string{"acme/keys/client.pem": "secret"})
+	os.Chmod(path.Join(home, "chef/acme/keys/client.pem"), 0600)
+	os.Symlink("keys/client.pem", path.Join(home, "chef/acme/client.pem"))
+	return home
+}
+
+func TestCopyEnvironmentWithOverrides(t *testing.T) {
+	setUpTest()
+	home := setUpCopyHome(t)
+	a, _ := NewApp("aws", home)
+	if err := a.Copy("dev", "qa", map[string]string{"username": "qa"}); err != nil {
+		t.Fatalf("Expected copy to succeed, received error %s", err.Error())
+	}
+	env, _ := a.NewEnv("qa")
+	if env.Variables["region"] != "us-east-1" || env.Variables["username"] != "qa" {
+		t.Errorf("Expected copied region and overridden username, found %v", env.Variables)
+	}
+	if err := a.Copy("dev", "qa", map[string]string{}); err == nil {
+		t.Error("Expected error copying over an existing environment but did not receive one")
+	}
+	if err := a.Copy("dev", "prod", map[string]string{"nope": "x"}); err == nil {
+		t.Error("Expected error setting an unknown variable but did not receive one")
+	}
+	if err := a.Copy("dev", "staging", map[string]string{"AWS_USER": "staging"}); err != nil {
+		t.Fatalf("Expected copy to accept the name a variable is exported as, received error %s", err.Error())
+	}
+	if env, _ := a.NewEnv("staging"); env.Variables["username"] != "staging" {
+		t.Errorf("Expected username to be set through AWS_USER, found %v", env.Variables)
+	}
+}
+
+func TestCopyDirectory(t *testing.T) {
+	setUpTest()
+	home := setUpCopyHome(t)
+	a, _ := NewApp("chef", home)
+	if err := a.Copy("acme", "dyncorp", map[string]string{}); err != nil {
+		t.Fatalf("Expected copy to succeed, received error %s", err.Error())
+	}
+	copied := path.Join(a.Path, "dyncorp")
+	if d, _ := ioutil.ReadFile(path.Join(copied, "keys/client.pem")); string(d) != "secret" {
+		t.Errorf("Expected keys/client.pem to be copied to %s", copied)
+	}
+	if fi, _ := os.Stat(path.Join(copied, "keys/client.pem")); fi == nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("Expected keys/client.pem to keep its mode, found %v", fi)
+	}
+	if source, _ := os.Readlink(path.Join(copied, "client.pem")); source != "keys/client.pem" {
+		t.Errorf("Expected symlink to be copied as a symlink, found %s", source)
+	}
+	if err := a.Copy("acme", "other", map[string]string{"key": "value"}); err == nil {
+		t.Error("Expected error setting variables of a directory environment but did not receive one")
+	}
+}
+
+func TestMoveRepointsCurrent(t *testing.T) {
+	setUpTest()
+	home := setUpCopyHome(t)
+	a, _ := NewApp("chef", home)
+	if err := a.MakeCurrent("acme"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := a.Move("acme", "megacorp"); err != nil {
+		t.Fatalf("Expected move to succeed, received error %s", err.Error())
+	}
+	megacorp := path.Join(a.Path, "megacorp")
+	for _, link := range []string{path.Join(a.Path, "current"), a.Target} {
+		if source, _ := os.Readlink(link); source != megacorp {
+			t.Errorf("Expected %s to point at %s, found %s", link, megacorp, source)
+		}
+	}
+	if _, err := os.Stat(path.Join(a.Path, "acme")); !os.IsNotExist(err) {
+		t.Error("Expected acme to be gone after the move")
+	}
+}
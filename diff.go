@@ -0,0 +1,297 @@
+package sellsword
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Change is one difference between two environments. Key is a variable name for
+// environment applications and a path relative to the environment otherwise.
+// Kind is added, removed or changed, from the first environment to the second
+type Change struct {
+	Key  string `json:"key"`
+	Kind string `json:"kind"`
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+	// Diff is the unified diff of a changed text file
+	Diff string `json:"diff,omitempty"`
+}
+
+// DiffOptions control how much of the values Diff reveals
+type DiffOptions struct {
+	KeysOnly    bool
+	ShowSecrets bool
+}
+
+// Diff compares the environments envA and envB. Environment environments are
+// compared variable by variable, the others file by file
+func (a *App) Diff(envA string, envB string, options DiffOptions) ([]Change, error) {
+	for _, envName := range []string{envA, envB} {
+		if err := a.checkEnvExists(envName); err != nil {
+			return nil, err
+		}
+	}
+	if a.EnvType == "environment" {
+		return a.diffVariables(envA, envB, options)
+	}
+	return diffPaths(path.Join(a.Path, envA), path.Join(a.Path, envB), "")
+}
+
+func (a *App) diffVariables(envA string, envB string, options DiffOptions) ([]Change, error) {
+	from, err := a.NewEnv(envA)
+	if err != nil {
+		return nil, err
+	}
+	to, err := a.NewEnv(envB)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0)
+	for _, variables := range []map[string]string{from.Variables, to.Variables} {
+		for k := range variables {
+			keys = appendIfMissing(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	changes := make([]Change, 0)
+	for _, k := range keys {
+		old, inFrom := from.Variables[k]
+		new, inTo := to.Variables[k]
+		c := Change{Key: k}
+		if !inFrom {
+			c.Kind = "added"
+		} else if !inTo {
+			c.Kind = "removed"
+		} else if old != new {
+			c.Kind = "changed"
+		} else {
+			continue
+		}
+		if !options.KeysOnly {
+			if inFrom {
+				c.Old = old
+			}
+			if inTo {
+				c.New = new
+			}
+			if from.IsSecret(k) && !options.ShowSecrets {
+				c.Old, c.New = maskIfSet(c.Old), maskIfSet(c.New)
+			}
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+func maskIfSet(value string) string {
+	if value == "" {
+		return ""
+	}
+	return MaskedValue
+}
+
+// diffPaths compares the files at rel below the environments fromRoot and toRoot
+func diffPaths(fromRoot string, toRoot string, rel string) ([]Change, error) {
+	from, to := path.Join(fromRoot, rel), path.Join(toRoot, rel)
+	fromInfo, err := os.Lstat(from)
+	if err != nil {
+		return nil, err
+	}
+	toInfo, err := os.Lstat(to)
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]Change, 0)
+	if fromInfo.IsDir() && toInfo.IsDir() {
+		names := make([]string, 0)
+		for _, dir := range []string{from, to} {
+			di, err := ioutil.ReadDir(dir)
+			if err != nil {
+				return nil, err
+			}
+			for i := range di {
+				names = appendIfMissing(names, di[i].Name())
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			_, fromErr := os.Lstat(path.Join(from, name))
+			_, toErr := os.Lstat(path.Join(to, name))
+			if fromErr != nil {
+				changes = append(changes, Change{Key: path.Join(rel, name), Kind: "added"})
+			} else if toErr != nil {
+				changes = append(changes, Change{Key: path.Join(rel, name), Kind: "removed"})
+			} else if sub, err := diffPaths(fromRoot, toRoot, path.Join(rel, name)); err != nil {
+				return nil, err
+			} else {
+				changes = append(changes, sub...)
+			}
+		}
+		return changes, nil
+	}
+	// the environment itself for file applications
+	key := rel
+	if key == "" {
+		key = "."
+	}
+	fromKind, toKind := fileKind(fromInfo), fileKind(toInfo)
+	if fromKind != toKind {
+		return append(changes, Change{Key: key, Kind: "changed", Old: fromKind, New: toKind}), nil
+	}
+	if fromKind == "symlink" {
+		fromSource, _ := os.Readlink(from)
+		toSource, _ := os.Readlink(to)
+		if fromSource != toSource {
+			changes = append(changes, Change{Key: key, Kind: "changed", Old: fromSource, New: toSource})
+		}
+		return changes, nil
+	}
+	fromData, err := ioutil.ReadFile(from)
+	if err != nil {
+		return nil, err
+	}
+	toData, err := ioutil.ReadFile(to)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(fromData, toData) {
+		return changes, nil
+	}
+	c := Change{Key: key, Kind: "changed"}
+	if isText(fromData) && isText(toData) {
+		c.Diff = unifiedDiff(path.Join(path.Base(fromRoot), rel), path.Join(path.Base(toRoot), rel),
+			splitLines(string(fromData)), splitLines(string(toData)))
+	}
+	return append(changes, c), nil
+}
+
+func fileKind(fi os.FileInfo) string {
+	if fi.Mode()&os.ModeSymlink == os.ModeSymlink {
+		return "symlink"
+	} else if fi.IsDir() {
+		return "directory"
+	}
+	return "file"
+}
+
+// isText guesses whether data is text the way diff(1) does, by looking for NUL bytes
+func isText(data []byte) bool {
+	return bytes.IndexByte(data, 0) < 0
+}
+
+// splitLines splits text into lines, keeping their newlines
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// maxDiffCells bounds the work unifiedDiff does for large files
+const maxDiffCells = 4000000
+
+const diffContext = 3
+
+// unifiedDiff returns the differences between the lines from and to in unified
+// format, with three lines of context around each change
+func unifiedDiff(fromName string, toName string, from []string, to []string) string {
+	header := fmt.Sprintf("--- %s\n+++ %s\n", fromName, toName)
+	if len(from)*len(to) > maxDiffCells {
+		return header + "Files are too large to compare line by line\n"
+	}
+	// lcs[i][j] is the length of the longest common subsequence of from[i:] and to[j:]
+	lcs := make([][]int, len(from)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	type op struct {
+		kind byte
+		line string
+		i, j int
+	}
+	ops := make([]op, 0, len(from)+len(to))
+	i, j := 0, 0
+	for i < len(from) || j < len(to) {
+		if i < len(from) && j < len(to) && from[i] == to[j] {
+			ops = append(ops, op{' ', from[i], i, j})
+			i, j = i+1, j+1
+		} else if i < len(from) && (j == len(to) || lcs[i+1][j] >= lcs[i][j+1]) {
+			ops = append(ops, op{'-', from[i], i, j})
+			i++
+		} else {
+			ops = append(ops, op{'+', to[j], i, j})
+			j++
+		}
+	}
+	var out bytes.Buffer
+	out.WriteString(header)
+	for start := 0; start < len(ops); {
+		if ops[start].kind == ' ' {
+			start++
+			continue
+		}
+		// grow the hunk until changes are more than twice the context apart
+		first := start - diffContext
+		if first < 0 {
+			first = 0
+		}
+		last := start
+		for k := start; k < len(ops) && k <= last+2*diffContext; k++ {
+			if ops[k].kind != ' ' {
+				last = k
+			}
+		}
+		end := last + diffContext + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+		fromCount, toCount := 0, 0
+		for _, o := range ops[first:end] {
+			if o.kind != '+' {
+				fromCount++
+			}
+			if o.kind != '-' {
+				toCount++
+			}
+		}
+		out.WriteString(fmt.Sprintf("@@ -%s +%s @@\n", hunkRange(ops[first].i, fromCount),
+			hunkRange(ops[first].j, toCount)))
+		for _, o := range ops[first:end] {
+			out.WriteByte(o.kind)
+			out.WriteString(o.line)
+			if !strings.HasSuffix(o.line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		start = end
+	}
+	return out.String()
+}
+
+// hunkRange formats the start and length of a hunk, counting lines from 1 and
+// pointing before the hunk when it is empty, as diff -u does
+func hunkRange(start int, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	} else if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
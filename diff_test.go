@@ -0,0 +1,82 @@
+package sellsword
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestDiffVariables(t *testing.T) {
+	setUpTest()
+	a := setUpApp(t, "aws", "type: environment\nvariables:\n  - access_key=AWS_ACCESS_KEY_ID\n"+
+		"  - secret_key=AWS_SECRET_ACCESS_KEY\n  - region=AWS_REGION\nsecrets:\n  - secret_key\n", acmeKeys)
+	ioutil.WriteFile(path.Join(a.Path, "qa"), []byte("access_key: AKIA\nsecret_key: hunter3\nregion: eu\n"), 0644)
+	changes, err := a.Diff("acme", "qa", DiffOptions{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := []Change{{Key: "region", Kind: "added", New: "eu"},
+		{Key: "secret_key", Kind: "changed", Old: MaskedValue, New: MaskedValue}}
+	if len(changes) != len(expected) || changes[0] != expected[0] || changes[1] != expected[1] {
+		t.Errorf("Expected changes %v, found %v", expected, changes)
+	}
+	changes, _ = a.Diff("acme", "qa", DiffOptions{ShowSecrets: true})
+	if changes[1].Old != "hunter2" || changes[1].New != "hunter3" {
+		t.Errorf("Expected secrets to be shown, found %v", changes[1])
+	}
+	changes, _ = a.Diff("acme", "qa", DiffOptions{KeysOnly: true})
+	if changes[0].New != "" || changes[1].Old != "" {
+		t.Errorf("Expected keys only, found %v", changes)
+	}
+}
+
+func TestDiffDirectories(t *testing.T) {
+	setUpTest()
+	home := setUpCopyHome(t)
+	a, _ := NewApp("chef", home)
+	a.Copy("acme", "dyncorp", map[string]string{})
+	ioutil.WriteFile(path.Join(a.Path, "acme/knife.rb"), []byte("a\nb\nc\n"), 0644)
+	ioutil.WriteFile(path.Join(a.Path, "dyncorp/knife.rb"), []byte("a\nB\nc\n"), 0644)
+	ioutil.WriteFile(path.Join(a.Path, "dyncorp/keys/extra.pem"), []byte("x"), 0644)
+	os.Remove(path.Join(a.Path, "dyncorp/client.pem"))
+	changes, err := a.Diff("acme", "dyncorp", DiffOptions{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	kinds := make([]string, len(changes))
+	for i := range changes {
+		kinds[i] = changes[i].Key + " " + changes[i].Kind
+	}
+	if strings.Join(kinds, ", ") != "client.pem removed, keys/extra.pem added, knife.rb changed" {
+		t.Errorf("Expected file level changes, found %v", kinds)
+	}
+	expected := "--- acme/knife.rb\n+++ dyncorp/knife.rb\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"
+	if changes[2].Diff != expected {
+		t.Errorf("Expected unified diff\n%s\nfound\n%s", expected, changes[2].Diff)
+	}
+}
+
+// compare with diff -u where it is installed
+func TestUnifiedDiffMatchesDiff(t *testing.T) {
+	tmp := setUpTest()
+	from := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n"
+	to := "0\n1\n2\n3\nfour\n5\n6\n7\n8\n9\n10\n11\n12\n14\n15\n16\nseventeen"
+	fromFile, toFile := path.Join(tmp, "from"), path.Join(tmp, "to")
+	ioutil.WriteFile(fromFile, []byte(from), 0644)
+	ioutil.WriteFile(toFile, []byte(to), 0644)
+	defer os.Remove(fromFile)
+	defer os.Remove(toFile)
+	out, err := exec.Command("diff", "-u", fromFile, toFile).Output()
+	if len(out) == 0 {
+		t.Skipf("diff -u is not available: %v", err)
+	}
+	// drop the headers, which carry timestamps
+	expected := strings.SplitN(string(out), "\n", 3)[2]
+	actual := strings.SplitN(unifiedDiff("from", "to", splitLines(from), splitLines(to)), "\n", 3)[2]
+	if actual != expected {
+		t.Errorf("Expected\n%s\nfound\n%s", expected, actual)
+	}
+}
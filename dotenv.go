@@ -0,0 +1,120 @@
+package sellsword
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var dotenvKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// ParseValues reads variable values given either as YAML, which may be nested, or
+// in dotenv format, i.e. KEY=value lines optionally prefixed with export
+func ParseValues(data []byte) (map[string]string, error) {
+	if isDotenv(string(data)) {
+		return parseDotenv(string(data))
+	}
+	return flattenYaml(data, func(string) string { return defaultSeparator }, nil)
+}
+
+// isDotenv reports whether every line with content assigns with = rather than
+// mapping with : as YAML does
+func isDotenv(data string) bool {
+	found := false
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		eq := strings.Index(line, "=")
+		colon := strings.Index(line, ":")
+		if eq < 0 || (colon >= 0 && colon < eq) {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+func parseDotenv(data string) (map[string]string, error) {
+	values := make(map[string]string)
+	for i, line := range strings.Split(data, "\n") {
+		if a, err := parseDotenvLine(i+1, line); err != nil {
+			return values, err
+		} else if a != nil {
+			values[a.key] = a.value
+		}
+	}
+	return values, nil
+}
+
+// dotenvAssignment is a KEY=value line of a dotenv file. prefix is everything up
+// to the value, such as export and the key, and comment whatever follows it
+type dotenvAssignment struct {
+	prefix  string
+	key     string
+	value   string
+	comment string
+}
+
+// parseDotenvLine reads the assignment on line n, or returns nil for blank lines
+// and comments
+func parseDotenvLine(n int, line string) (*dotenvAssignment, error) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return nil, nil
+	}
+	eq := strings.Index(line, "=")
+	if eq < 0 {
+		return nil, errors.New(fmt.Sprintf("Line %d is not of the form KEY=value: %s", n, trimmed))
+	}
+	key := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line[:eq]), "export "))
+	if !dotenvKey.MatchString(key) {
+		return nil, errors.New(fmt.Sprintf("Line %d is not of the form KEY=value: %s", n, trimmed))
+	}
+	raw := strings.TrimRight(line[eq+1:], " \t\r")
+	value := strings.TrimLeft(raw, " \t")
+	a := &dotenvAssignment{prefix: line[:eq+1] + raw[:len(raw)-len(value)], key: key}
+	var err error
+	if a.value, a.comment, err = dotenvValue(value); err != nil {
+		return nil, errors.New(fmt.Sprintf("Line %d: %s", n, err.Error()))
+	}
+	return a, nil
+}
+
+// dotenvValue unquotes value and returns it along with a comment that follows
+// it. Double quoted values understand the escapes \n, \t, \" and \\, single
+// quoted values are taken literally and unquoted values end at a comment
+func dotenvValue(value string) (string, string, error) {
+	if !strings.HasPrefix(value, "'") && !strings.HasPrefix(value, `"`) {
+		if i := strings.Index(value, " #"); i >= 0 {
+			return strings.TrimSpace(value[:i]), value[i:], nil
+		}
+		return value, "", nil
+	}
+	quote := value[:1]
+	// the closing quote is the last one followed by nothing but a comment
+	for end := strings.LastIndex(value, quote); end > 0; end = strings.LastIndex(value[:end], quote) {
+		rest := strings.TrimSpace(value[end+1:])
+		if (rest != "" && !strings.HasPrefix(rest, "#")) || (quote == `"` && isEscaped(value, end)) {
+			continue
+		}
+		if quote == "'" {
+			return value[1:end], value[end+1:], nil
+		}
+		replacer := strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`)
+		return replacer.Replace(value[1:end]), value[end+1:], nil
+	}
+	return "", "", errors.New(fmt.Sprintf("unterminated quote in %s", value))
+}
+
+// isEscaped reports whether the character at i follows an odd number of backslashes
+func isEscaped(value string, i int) bool {
+	n := 0
+	for i > 0 && value[i-1] == '\\' {
+		n++
+		i--
+	}
+	return n%2 == 1
+}
@@ -0,0 +1,59 @@
+package sellsword
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseValuesYaml(t *testing.T) {
+	values, err := ParseValues([]byte("username: macgyver\nurl: http://example.com/?a=b\n"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if values["username"] != "macgyver" || values["url"] != "http://example.com/?a=b" {
+		t.Errorf("Expected YAML values, found %v", values)
+	}
+}
+
+func TestParseValuesDotenv(t *testing.T) {
+	data := `# credentials
+export AWS_ACCESS_KEY_ID=abc
+region=us-east-1 # the default
+password='it''s $ecret'
+motd="hello\nworld"
+url=http://example.com:8080
+greeting="a b" # note
+`
+	values, err := ParseValues([]byte(data))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := map[string]string{"AWS_ACCESS_KEY_ID": "abc", "region": "us-east-1",
+		"password": "it''s $ecret", "motd": "hello\nworld", "url": "http://example.com:8080",
+		"greeting": "a b"}
+	for k, v := range expected {
+		if values[k] != v {
+			t.Errorf("Expected %s to be %q, found %q", k, v, values[k])
+		}
+	}
+}
+
+func TestParseValuesDotenvErrors(t *testing.T) {
+	for _, data := range []string{"A=1\n1B=2\n", "A=\"unterminated\n", "A=\"a b\" c\n"} {
+		if _, err := parseDotenv(data); err == nil {
+			t.Errorf("Expected error parsing %q but did not receive one", data)
+		}
+	}
+}
+
+func TestFormatDotenvKeepsLines(t *testing.T) {
+	lines := strings.Split("# credentials\nexport access_key=AKIA # rotated yearly\n\nregion=us-east-1\n"+
+		"secret_key='hunter 2'\n", "\n")
+	keys := []string{"access_key", "secret_key", "zone"}
+	values := map[string]string{"access_key": "AKIB", "secret_key": "hunter 2", "zone": "a"}
+	d := formatDotenv("base", keys, values, lines)
+	expected := "extends=base\n# credentials\nexport access_key=AKIB # rotated yearly\n\nsecret_key='hunter 2'\nzone=a\n"
+	if string(d) != expected {
+		t.Errorf("Expected\n%s\nfound\n%s", expected, d)
+	}
+}
@@ -0,0 +1,129 @@
+package sellsword
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// runEditor opens file in $EDITOR, which may include arguments such as `code -w`
+func runEditor(file string) error {
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		return errors.New("Set $EDITOR to edit environments")
+	}
+	cmd := exec.Command(editor[0], append(editor[1:], file)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// Edit opens the environment envName in $EDITOR. Environment and file
+// environments are edited in a copy that only replaces the original once the
+// editor exits and, for environment environments, the copy is valid YAML that
+// satisfies the definition. If the environment is current its variables are
+// exported again. The application is locked until the editor exits, so that
+// changes made meanwhile by other sellsword processes are not lost
+func (a *App) Edit(envName string) error {
+	if err := a.checkEnvExists(envName); err != nil {
+		return err
+	}
+	unlock, err := a.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	envPath := path.Join(a.Path, envName)
+	if a.EnvType == "directory" {
+		if err := runEditor(envPath); err != nil {
+			return err
+		}
+		for _, m := range a.Mappings {
+			if err := m.check(envPath); err != nil {
+				Logger.Warnln(err.Error())
+			}
+		}
+		return nil
+	}
+	original, err := ioutil.ReadFile(envPath)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(envPath)
+	if err != nil {
+		return err
+	}
+	// a dot file next to the original, so that ListEnvs ignores it and the
+	// rename into place is atomic
+	tmp := path.Join(a.Path, fmt.Sprintf(".%s.ssw-edit-%d", envName, os.Getpid()))
+	if err := ioutil.WriteFile(tmp, original, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	for {
+		if err := runEditor(tmp); err != nil {
+			return err
+		}
+		edited, err := ioutil.ReadFile(tmp)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(edited, original) {
+			Logger.Infof("Environment %s of application %s is unchanged", envName, a.Name)
+			return nil
+		}
+		invalid := a.checkEdited(envName, tmp)
+		if invalid == nil {
+			break
+		}
+		red := GetTermPrinterF(color.FgRed)
+		fmt.Fprint(Out, red("%s\n", invalid.Error()))
+		if !isatty.IsTerminal(os.Stdin.Fd()) || !Confirm("Edit the environment again? Answering no discards your changes") {
+			return errors.New(fmt.Sprintf("Discarded the changes to environment %s of application %s",
+				envName, a.Name))
+		}
+	}
+	if err := os.Rename(tmp, envPath); err != nil {
+		return err
+	}
+	green := GetTermPrinterF(color.FgGreen)
+	fmt.Fprint(Out, green("Saved environment %s of application %s\n", envName, a.Name))
+	if a.EnvType == "environment" && linksTo(a.currentLink(), envName) {
+		env, err := a.NewEnv(envName)
+		if err != nil {
+			return err
+		}
+		a.UnsetExportVars()
+		env.Load()
+	}
+	return nil
+}
+
+// checkEdited reports whether the edited copy at tmp is a valid version of the
+// environment envName
+func (a *App) checkEdited(envName string, tmp string) error {
+	if a.EnvType != "environment" {
+		return nil
+	}
+	env, err := a.NewEnv(envName)
+	if err != nil {
+		return err
+	}
+	// load from the copy but report problems against the environment's name
+	env.Path = tmp
+	env.Variables, err = env.loadVariables()
+	env.Path = path.Join(a.Path, envName)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Environment %s is not valid %s: %s", envName,
+			formatNames[env.formatOf(envName)], err.Error()))
+	}
+	return env.Validate()
+}
@@ -0,0 +1,68 @@
+package sellsword
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// setUpEditor points $EDITOR at a script that replaces the file it is given with
+// contents
+func setUpEditor(t *testing.T, tmp string, contents string) func() {
+	edited := path.Join(tmp, "edited")
+	ioutil.WriteFile(edited, []byte(contents), 0644)
+	script := path.Join(tmp, "editor.sh")
+	ioutil.WriteFile(script, []byte("#!/bin/sh\ncat "+edited+" > \"$1\"\n"), 0755)
+	original := os.Getenv("EDITOR")
+	os.Setenv("EDITOR", script)
+	return func() {
+		os.Setenv("EDITOR", original)
+		os.Remove(script)
+		os.Remove(edited)
+	}
+}
+
+func TestEditReexportsCurrent(t *testing.T) {
+	tmp := setUpTest()
+	a := setUpApp(t, "aws", schemaDefinition, nil)
+	ioutil.WriteFile(path.Join(a.Path, "dev"), []byte("access_key: AKIA\nregion: us-east-1\ntier: dev\n"), 0644)
+	if err := a.MakeCurrent("dev"); err != nil {
+		t.Fatal(err.Error())
+	}
+	defer setUpEditor(t, tmp, "access_key: AKIA\nregion: eu-west-1\ntier: dev\n")()
+	var out bytes.Buffer
+	EvalOut = &out
+	defer func() { EvalOut = os.Stdout }()
+	if err := a.Edit("dev"); err != nil {
+		t.Fatalf("Expected edit to succeed, received error %s", err.Error())
+	}
+	if d, _ := ioutil.ReadFile(path.Join(a.Path, "dev")); !strings.Contains(string(d), "eu-west-1") {
+		t.Errorf("Expected edited env to be saved, found %s", d)
+	}
+	if !strings.Contains(out.String(), "unset AWS_REGION") || !strings.Contains(out.String(), "AWS_REGION=eu-west-1") {
+		t.Errorf("Expected refreshed exports, found %s", out.String())
+	}
+}
+
+func TestEditRejectsInvalid(t *testing.T) {
+	tmp := setUpTest()
+	a := setUpApp(t, "aws", schemaDefinition, nil)
+	original := "access_key: AKIA\nregion: us-east-1\ntier: dev\n"
+	ioutil.WriteFile(path.Join(a.Path, "dev"), []byte(original), 0644)
+	for _, edited := range []string{"access_key: [AKIA\n", "access_key: AKIA\nregion: moon\ntier: dev\n"} {
+		restore := setUpEditor(t, tmp, edited)
+		if err := a.Edit("dev"); err == nil {
+			t.Errorf("Expected error saving %q but did not receive one", edited)
+		}
+		restore()
+		if d, _ := ioutil.ReadFile(path.Join(a.Path, "dev")); string(d) != original {
+			t.Errorf("Expected env to be left alone, found %s", d)
+		}
+	}
+	if envs := a.ListEnvs(); len(envs) != 1 {
+		t.Errorf("Expected no leftover copies, found %v", envs)
+	}
+}
@@ -2,9 +2,10 @@ package sellsword
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"github.com/fatih/color"
-	"gopkg.in/yaml.v2"
+	"github.com/mattn/go-isatty"
 	"io/ioutil"
 	"os"
 	"path"
@@ -17,28 +18,64 @@ type Env struct {
 	Path            string
 	Current         bool
 	EnvType         string
+	Template        string
 	ExportVariables map[string]string
 	Variables       map[string]string
+	// VariableNames keeps the variables in the order the application defines them
+	VariableNames []string
+	// Secrets are the variables whose values are never shown
+	Secrets        []string
+	ConfirmSecrets bool
+	Schema         map[string]*Variable
+	// Separator joins the items of lists in the environment file
+	Separator string
+	// Format is the format of environment files whose name has no known extension
+	Format string
+	// Extends is the environment this one inherits the values it does not set from
+	Extends string
+	// Sources holds the environment each value comes from
+	Sources map[string]string
+	// inherited holds the values of the environments this one extends
+	inherited map[string]string
+	// layout records how the environment file writes its values
+	layout *envLayout
 }
 
 func NewEnv(name string, basePath string, exportVars map[string]string, vars []string,
 	envType string) (*Env, error) {
+	env := newEnv(name, basePath, exportVars, vars, envType)
+	return env, env.readVariables()
+}
+
+// newEnv initializes the Env struct without reading the environment file, so that
+// the settings of the application can be set before it is read
+func newEnv(name string, basePath string, exportVars map[string]string, vars []string, envType string) *Env {
 	env := new(Env)
 	env.Name = name
 	env.EnvType = envType
 	env.Path = path.Join(basePath, name)
+	env.VariableNames = vars
 	if envType == "environment" {
-		env.ExportVariables = exportVars
-		// load the Variables from file if they exist
-		if _, err := os.Stat(env.Path); err == nil {
-			if env.Variables, err = env.loadYaml(); err != nil {
-				return env, err
-			}
-		} else {
-			env.Variables = arrayToEmptyMap(vars)
+		// PopulateExportVars fills in the map, so it must not be shared with the App
+		env.ExportVariables = make(map[string]string, len(exportVars))
+		for k, v := range exportVars {
+			env.ExportVariables[k] = v
 		}
 	}
-	return env, nil
+	return env
+}
+
+// readVariables loads the Variables from file if they exist
+func (e *Env) readVariables() error {
+	if e.EnvType != "environment" {
+		return nil
+	}
+	if _, err := os.Stat(e.Path); err == nil {
+		e.Variables, err = e.loadVariables()
+		return err
+	}
+	e.Variables = arrayToEmptyMap(e.VariableNames)
+	return nil
 }
 
 // NewEnvironmentEnv is a factory method that properly initializes the Env struct for the env type of Environment
@@ -51,6 +88,14 @@ func NewDirectoryEnv(name string, basePath string) (*Env, error) {
 	return NewEnv(name, basePath, map[string]string{}, []string{}, "directory")
 }
 
+// NewFileEnv is a factory method that properly initializes the Env struct for the env type of File.
+// template, if set, is the file new environments start out as
+func NewFileEnv(name string, basePath string, template string) (*Env, error) {
+	env, err := NewEnv(name, basePath, map[string]string{}, []string{}, "file")
+	env.Template = template
+	return env, err
+}
+
 func (e *Env) Load() {
 	if e.EnvType == "environment" {
 		e.PopulateExportVars()
@@ -58,55 +103,77 @@ func (e *Env) Load() {
 	}
 }
 
-func (e *Env) loadYaml() (map[string]string, error) {
-	varMap := make(map[string]string)
-	if d, err := ioutil.ReadFile(e.Path); err != nil {
-		return varMap, err
-	} else {
-		err := yaml.Unmarshal(d, varMap)
-		return varMap, err
-	}
+func (e *Env) loadVariables() (map[string]string, error) {
+	return e.loadInherited()
 }
 
+// Save writes the variables to the environment file in its format. The file is
+// written under a temporary name and renamed into place, keeping the mode of the
+// file it replaces, so that it is readable only by its owner from the start if
+// the environment holds secrets
 func (e *Env) Save() error {
 	if e.EnvType != "environment" {
 		Logger.Warnf("Environment type %s does not currently support the save operation", e.EnvType)
 		return nil
 	}
-	if d, err := yaml.Marshal(&e.Variables); err != nil {
+	if d, err := formatEnvFile(e.formatOf(e.Name), e.Extends, e.savedKeys(), e.Variables, e.savedLayout()); err != nil {
 		return err
 	} else {
-		if err := ioutil.WriteFile(e.Path, d, 0775); err != nil {
-			return err
-		} else {
-			green := GetTermPrinterF(color.FgGreen)
-			fmt.Print(green("New environment created at %s\n", e.Path))
-			return nil
+		mode := os.FileMode(0644)
+		if fi, err := os.Stat(e.Path); err == nil {
+			mode = fi.Mode().Perm()
+		}
+		if len(e.Secrets) > 0 {
+			mode &^= 0077
 		}
+		return replaceFile(e.Path, d, mode)
 	}
 }
 
+// replaceFile writes d to file under a temporary name with the given mode and
+// renames it into place, so that file is never seen half written
+func replaceFile(file string, d []byte, mode os.FileMode) error {
+	tmp := path.Join(path.Dir(file), fmt.Sprintf(".%s.ssw-save-%d", path.Base(file), os.Getpid()))
+	os.Remove(tmp)
+	if err := ioutil.WriteFile(tmp, d, mode); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, mode); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
 func (e *Env) PopulateExportVars() error {
-	if yamlVars, err := e.loadYaml(); err != nil {
+	if raw, err := e.loadVariables(); err != nil {
+		return err
+	} else if yamlVars, err := e.interpolate(raw); err != nil {
 		return err
 	} else {
+		keys := make(map[string]string, len(e.ExportVariables))
 		for key, value := range e.ExportVariables {
+			keys[key] = value
 			if v, ok := yamlVars[value]; ok {
 				e.ExportVariables[key] = v
 			} else {
 				delete(e.ExportVariables, key)
 			}
 		}
-		Logger.Debugf("env export vars are %v", e.ExportVariables)
+		Logger.Debugf("env export vars are %v", e.maskedExportVars(keys))
 		return nil
 	}
 }
 
 // This is a separate function from PrintExports to make it easier to test
-func (e *Env) MakeExportStatements() string {
+func (e *Env) MakeExportStatements(sh Shell) string {
 	statements := make([]string, 0)
 	for key, value := range e.ExportVariables {
-		statements = append(statements, "export "+key+"="+value)
+		statements = append(statements, sh.Export(key, value))
 	}
 	// We sort it so that the output is easier to test
 	sort.Strings(statements)
@@ -114,30 +181,186 @@ func (e *Env) MakeExportStatements() string {
 }
 
 func (e *Env) PrintExports() {
-	fmt.Println(e.MakeExportStatements())
+	fmt.Fprintln(EvalOut, e.MakeExportStatements(OutputShell))
 }
 
 // *Constructs* a new environment, not to be confused w/ the Constructor NewEnv
-// In case of environment type, queries user for values
+// In case of environment type, takes the values of variables from values, keyed
+// by variable or environment variable name, and queries the user for the rest
+// in the order the application defines them. Fails if values are missing and
+// stdin is not a terminal
 // Not implemented for other types yet
-func (e *Env) Construct() error {
+func (e *Env) Construct(values map[string]string) error {
 	if e.EnvType == "environment" {
-		for k, _ := range e.Variables {
-			reader := bufio.NewReader(os.Stdin)
-			fmt.Printf("%s: ", k)
-			if text, err := reader.ReadString('\n'); err != nil {
+		if _, err := os.Stat(e.Path); err == nil {
+			return errors.New(fmt.Sprintf("Environment %s already exists at %s", e.Name, e.Path))
+		}
+		given, err := e.resolveValues(values)
+		if err != nil {
+			return err
+		}
+		for k, v := range given {
+			if err := e.variable(k).Validate(v); err != nil {
 				return err
-			} else {
-				e.Variables[k] = strings.TrimSpace(text)
 			}
 		}
+		interactive := isatty.IsTerminal(os.Stdin.Fd())
+		missing := make([]string, 0)
+		for _, k := range e.VariableNames {
+			if _, ok := given[k]; ok {
+				continue
+			}
+			v := e.variable(k)
+			if !interactive && v.Default != "" {
+				given[k] = v.Default
+			} else if interactive || v.IsRequired() {
+				missing = append(missing, k)
+			}
+		}
+		if len(missing) > 0 && !interactive {
+			return errors.New(fmt.Sprintf("Missing values for variables %s of environment %s",
+				strings.Join(missing, ", "), e.Name))
+		}
+		reader := bufio.NewReader(os.Stdin)
+		for _, k := range missing {
+			if value, err := e.promptVariable(reader, e.variable(k)); err != nil {
+				return err
+			} else if value != "" {
+				given[k] = value
+			}
+		}
+		e.Variables = given
 		if err := e.Save(); err != nil {
 			Logger.Errorf("error: %v", err)
 			return err
 		}
+		green := GetTermPrinterF(color.FgGreen)
+		fmt.Fprint(Out, green("New environment created at %s\n", e.Path))
+	} else if len(values) > 0 {
+		return errors.New(fmt.Sprintf("Variables can only be set for environments of type environment, "+
+			"%s is of type %s", e.Name, e.EnvType))
+	} else if e.EnvType == "file" {
+		return e.constructFile()
 	} else {
 		red := GetTermPrinterF(color.FgRed)
 		fmt.Fprint(os.Stderr, red("new command not implemented for environment type %s", e.EnvType))
 	}
 	return nil
 }
+
+// resolveValues maps the keys of values, which may be environment variable names
+// as found in dotenv files, to variable names and rejects unknown keys
+func (e *Env) resolveValues(values map[string]string) (map[string]string, error) {
+	resolved := make(map[string]string, len(values))
+	for k, v := range values {
+		if name, ok := e.variableName(k); ok {
+			resolved[name] = v
+		} else {
+			return resolved, errors.New(fmt.Sprintf("%s is not a variable of environment %s", k, e.Name))
+		}
+	}
+	return resolved, nil
+}
+
+// variableName returns the name of the variable key, which may also be the name
+// of an environment variable it is exported as
+func (e *Env) variableName(key string) (string, bool) {
+	if contains(e.VariableNames, key) {
+		return key, true
+	}
+	name, ok := e.ExportVariables[key]
+	return name, ok
+}
+
+// variable returns the schema of the variable key, which for environments made
+// without an application is just its key
+func (e *Env) variable(key string) *Variable {
+	if v, ok := e.Schema[key]; ok {
+		return v
+	}
+	return &Variable{Key: key, Secret: e.IsSecret(key)}
+}
+
+// promptVariable asks for the value of v until the user gives a valid one. An
+// empty answer takes the default
+func (e *Env) promptVariable(reader *bufio.Reader, v *Variable) (string, error) {
+	for {
+		var value string
+		if v.Secret || e.IsSecret(v.Key) {
+			var err error
+			if value, err = promptSecret(reader, v.prompt(), e.ConfirmSecrets); err != nil {
+				return value, err
+			}
+		} else {
+			fmt.Fprintf(Out, "%s: ", v.prompt())
+			if text, err := reader.ReadString('\n'); err != nil {
+				return value, err
+			} else {
+				value = strings.TrimSpace(text)
+			}
+		}
+		if value == "" {
+			value = v.Default
+		}
+		if err := v.Validate(value); err != nil {
+			red := GetTermPrinterF(color.FgRed)
+			fmt.Fprint(Out, red("%s\n", err.Error()))
+			continue
+		}
+		return value, nil
+	}
+}
+
+// Validate reports every variable whose value does not satisfy the schema of the
+// application, naming the file that holds the environment
+func (e *Env) Validate() error {
+	if e.EnvType != "environment" {
+		return nil
+	}
+	resolved, err := e.Resolved()
+	if err != nil {
+		return errors.New(fmt.Sprintf("Environment %s at %s: %s", e.Name, e.Path, err.Error()))
+	}
+	problems := make([]string, 0)
+	for _, k := range e.VariableNames {
+		if err := e.variable(k).Validate(resolved[k]); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(fmt.Sprintf("Environment %s at %s does not satisfy the definition of its application: %s",
+			e.Name, e.Path, strings.Join(problems, "; ")))
+	}
+	return nil
+}
+
+// constructFile creates a file environment from the template, if any, and then
+// opens it in $EDITOR
+func (e *Env) constructFile() error {
+	if _, err := os.Stat(e.Path); err == nil {
+		return errors.New(fmt.Sprintf("Environment %s already exists at %s", e.Name, e.Path))
+	}
+	editor := os.Getenv("EDITOR")
+	if e.Template == "" && editor == "" {
+		return errors.New("Set $EDITOR or a template for the application to create new environments")
+	}
+	var contents []byte
+	if e.Template != "" {
+		var err error
+		if contents, err = ioutil.ReadFile(e.Template); err != nil {
+			return err
+		}
+	}
+	if err := ioutil.WriteFile(e.Path, contents, 0600); err != nil {
+		return err
+	}
+	if editor != "" {
+		if err := runEditor(e.Path); err != nil {
+			os.Remove(e.Path)
+			return err
+		}
+	}
+	green := GetTermPrinterF(color.FgGreen)
+	fmt.Fprint(Out, green("New environment created at %s\n", e.Path))
+	return nil
+}
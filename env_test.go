@@ -1,6 +1,8 @@
 package sellsword
 
 import (
+	"github.com/mattn/go-isatty"
+	"io/ioutil"
 	"os"
 	"path"
 	"strings"
@@ -103,15 +105,27 @@ func TestEnvPrintExports(t *testing.T) {
 	vars := []string{"username", "password", "region"}
 	e, _ := NewEnvironmentEnv("acme", dir, exportVars, vars)
 	e.PopulateExportVars()
-	// Using TrimSpace so that extra new lines don't fail this test
-	actual := strings.TrimSpace(e.MakeExportStatements())
-	expected := strings.TrimSpace(`export PASSWORD=holdthestuffin
+	expected := map[Shell]string{
+		bashShell{}: `export PASSWORD=holdthestuffin
 export REGION=nowhere
-export USERNAME=mcmuffin
-`)
-	if actual != expected {
-		t.Errorf("Expected export statements did not match actual. Actual statements were \n%s\nExpected was %s",
-			actual, expected)
+export USERNAME=mcmuffin`,
+		zshShell{}: `typeset -gx PASSWORD=holdthestuffin
+typeset -gx REGION=nowhere
+typeset -gx USERNAME=mcmuffin`,
+		fishShell{}: `set -gx PASSWORD holdthestuffin
+set -gx REGION nowhere
+set -gx USERNAME mcmuffin`,
+		posixShell{}: `PASSWORD=holdthestuffin; export PASSWORD
+REGION=nowhere; export REGION
+USERNAME=mcmuffin; export USERNAME`,
+	}
+	for sh, statements := range expected {
+		// Using TrimSpace so that extra new lines don't fail this test
+		actual := strings.TrimSpace(e.MakeExportStatements(sh))
+		if actual != statements {
+			t.Errorf("Expected %s export statements did not match actual. Actual statements were \n%s\nExpected was %s",
+				sh.Name(), actual, statements)
+		}
 	}
 }
 
@@ -131,7 +145,7 @@ func TestEnvSave(t *testing.T) {
 	}
 	e.Save()
 	e, _ = NewEnvironmentEnv("new", dir, exportVars, vars)
-	e.loadYaml()
+	e.loadVariables()
 	for i := range vars {
 		if e.Variables[vars[i]] != values[i] {
 			t.Errorf("Expected env to have key %s with value %s, found %s", vars[i], values[i],
@@ -141,4 +155,78 @@ func TestEnvSave(t *testing.T) {
 	os.Remove(newEnvPath)
 }
 
+func TestConstructWithValues(t *testing.T) {
+	tmp := setUpTest()
+	exportVars := map[string]string{"USERNAME": "username", "REGION": "region"}
+	e, _ := NewEnvironmentEnv("values", tmp, exportVars, []string{"username", "region"})
+	os.Remove(e.Path)
+	defer os.Remove(e.Path)
+	if err := e.Construct(map[string]string{"username": "macgyver", "REGION": "badlands"}); err != nil {
+		t.Fatalf("Expected env to be constructed, received error %s", err.Error())
+	}
+	e, _ = NewEnvironmentEnv("values", tmp, exportVars, []string{"username", "region"})
+	if e.Variables["username"] != "macgyver" || e.Variables["region"] != "badlands" {
+		t.Errorf("Expected values to be saved, found %v", e.Variables)
+	}
+	if err := e.Construct(map[string]string{"username": "macgyver", "region": "badlands"}); err == nil {
+		t.Error("Expected error constructing an env that already exists but did not receive one")
+	}
+}
+
+func TestConstructRejectsBadValues(t *testing.T) {
+	tmp := setUpTest()
+	exportVars := map[string]string{"USERNAME": "username", "REGION": "region"}
+	e, _ := NewEnvironmentEnv("values", tmp, exportVars, []string{"username", "region"})
+	required := true
+	e.Schema = map[string]*Variable{"region": {Key: "region", Required: &required}}
+	os.Remove(e.Path)
+	defer os.Remove(e.Path)
+	if err := e.Construct(map[string]string{"username": "macgyver", "nope": "x"}); err == nil {
+		t.Error("Expected error for an unknown variable but did not receive one")
+	}
+	if !isatty.IsTerminal(os.Stdin.Fd()) {
+		if err := e.Construct(map[string]string{"username": "macgyver"}); err == nil {
+			t.Error("Expected error for a missing variable but did not receive one")
+		}
+	}
+	if _, err := os.Stat(e.Path); !os.IsNotExist(err) {
+		t.Errorf("Expected no env to be saved at %s", e.Path)
+	}
+}
+
+func TestConstructFileFromTemplate(t *testing.T) {
+	tmp := setUpTest()
+	wd, _ := os.Getwd()
+	template := path.Join(wd, "test/config/npmrc.template")
+	original := os.Getenv("EDITOR")
+	os.Setenv("EDITOR", "")
+	defer os.Setenv("EDITOR", original)
+	e, _ := NewFileEnv("npmrc", tmp, template)
+	os.Remove(e.Path)
+	defer os.Remove(e.Path)
+	if err := e.Construct(nil); err != nil {
+		t.Fatalf("Expected file env to be created from template, received error %s", err.Error())
+	}
+	expected, _ := ioutil.ReadFile(template)
+	actual, _ := ioutil.ReadFile(e.Path)
+	if string(actual) != string(expected) {
+		t.Errorf("Expected new env to contain %s, found %s", expected, actual)
+	}
+	if err := e.Construct(nil); err == nil {
+		t.Error("Expected error constructing file env that already exists but did not receive one")
+	}
+}
+
+func TestConstructFileWithoutTemplateOrEditor(t *testing.T) {
+	tmp := setUpTest()
+	original := os.Getenv("EDITOR")
+	os.Setenv("EDITOR", "")
+	defer os.Setenv("EDITOR", original)
+	e, _ := NewFileEnv("npmrc", tmp, "")
+	os.Remove(e.Path)
+	if err := e.Construct(nil); err == nil {
+		t.Error("Expected error constructing file env without template or editor but did not receive one")
+	}
+}
+
 // test Construct, not sure how to do this
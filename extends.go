@@ -0,0 +1,171 @@
+package sellsword
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// extendsKey names, in an environment file, the environment it inherits values from
+const extendsKey = "extends"
+
+// extendsValue matches a value that is quoted or runs up to whitespace or a comment
+const extendsValue = `("(?:[^"\\]|\\.)*"|'[^']*'|[^\s#,}]+)`
+
+// extendsLines match where extends is set in an environment file of each format,
+// the value being the second group
+var extendsLines = map[string]*regexp.Regexp{
+	"yaml":   regexp.MustCompile(`(?m)^(extends[ \t]*:[ \t]*)` + extendsValue),
+	"dotenv": regexp.MustCompile(`(?m)^((?:export[ \t]+)?extends[ \t]*=[ \t]*)` + extendsValue),
+	"json":   regexp.MustCompile(`("extends"\s*:\s*)` + extendsValue),
+	"toml":   regexp.MustCompile(`(?m)^(extends[ \t]*=[ \t]*)` + extendsValue),
+}
+
+// readEnvFile returns the variables set in the file of the environment envName,
+// keyed by their dotted paths, and the environment it extends, if any. The
+// layout of the file is recorded in layout unless it is nil
+func (e *Env) readEnvFile(envName string, file string, layout *envLayout) (map[string]string, string, error) {
+	d, err := ioutil.ReadFile(file)
+	if err != nil {
+		return make(map[string]string), "", err
+	}
+	varMap, err := e.parseEnvFile(e.formatOf(envName), d, layout)
+	if err != nil {
+		return varMap, "", err
+	}
+	extends := varMap[extendsKey]
+	delete(varMap, extendsKey)
+	return varMap, extends, nil
+}
+
+// loadInherited reads the environment file and merges in the values of the
+// environments it extends, nearest first, so that an environment overrides the
+// environments it extends. It records where each value comes from in Sources
+func (e *Env) loadInherited() (map[string]string, error) {
+	e.layout = newEnvLayout()
+	varMap, extends, err := e.readEnvFile(e.Name, e.Path, e.layout)
+	if err != nil {
+		return varMap, err
+	}
+	e.Extends = extends
+	e.Sources = make(map[string]string, len(varMap))
+	e.inherited = make(map[string]string)
+	for k := range varMap {
+		e.Sources[k] = e.Name
+	}
+	chain := []string{e.Name}
+	for parent := extends; parent != ""; {
+		if contains(chain, parent) {
+			return varMap, errors.New(fmt.Sprintf("Environment %s extends itself: %s", e.Name,
+				strings.Join(append(chain, parent), " -> ")))
+		}
+		if parent == "current" || strings.HasPrefix(parent, ".") || strings.Contains(parent, "/") {
+			return varMap, errors.New(fmt.Sprintf("Environment %s extends %s, which is not a valid environment name",
+				chain[len(chain)-1], parent))
+		}
+		parentVars, next, err := e.readEnvFile(parent, path.Join(path.Dir(e.Path), parent), nil)
+		if os.IsNotExist(err) {
+			return varMap, errors.New(fmt.Sprintf("Environment %s extends %s, which does not exist",
+				chain[len(chain)-1], parent))
+		} else if err != nil {
+			return varMap, errors.New(fmt.Sprintf("Environment %s extended by %s: %s", parent, e.Name, err.Error()))
+		}
+		for k, v := range parentVars {
+			if _, ok := e.inherited[k]; !ok {
+				e.inherited[k] = v
+			}
+			if _, ok := varMap[k]; !ok {
+				varMap[k] = v
+				e.Sources[k] = parent
+			}
+		}
+		chain = append(chain, parent)
+		parent = next
+	}
+	return varMap, nil
+}
+
+// setExtends points the environment file at parent by replacing the value of
+// extends alone, keeping the rest of the file as it is written. It returns what
+// the file held before
+func (e *Env) setExtends(parent string) ([]byte, error) {
+	d, err := ioutil.ReadFile(e.Path)
+	if err != nil {
+		return d, err
+	}
+	fi, err := os.Stat(e.Path)
+	if err != nil {
+		return d, err
+	}
+	format := e.formatOf(e.Name)
+	quoted := parent
+	if format == "dotenv" {
+		quoted = dotenvQuote(parent)
+	} else if format == "json" {
+		quoted = jsonString(parent)
+	} else if format == "toml" {
+		quoted = tomlString(parent)
+	} else if out, err := yaml.Marshal(parent); err == nil {
+		quoted = strings.TrimSuffix(string(out), "\n")
+	}
+	changed := d
+	if m := extendsLines[format].FindSubmatchIndex(d); m != nil {
+		changed = append(append(append([]byte{}, d[:m[4]]...), quoted...), d[m[5]:]...)
+	}
+	if values, err := e.parseEnvFile(format, changed, nil); err != nil || values[extendsKey] != parent {
+		return d, errors.New(fmt.Sprintf("Could not point environment %s at %s, change extends in %s by hand",
+			e.Name, parent, e.Path))
+	}
+	return d, replaceFile(e.Path, changed, fi.Mode().Perm())
+}
+
+// savedKeys returns the variables Save writes, which are only those the
+// environment sets itself if it extends another
+func (e *Env) savedKeys() []string {
+	keys := make([]string, 0, len(e.Variables))
+	for k, v := range e.Variables {
+		inherited, ok := e.inherited[k]
+		if e.Extends == "" || e.Sources[k] == e.Name || !ok || inherited != v {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Source returns the name of the environment the value of the variable key
+// comes from, which is the environment itself unless it inherits the value
+func (e *Env) Source(key string) string {
+	if source, ok := e.Sources[key]; ok {
+		return source
+	}
+	return e.Name
+}
+
+// extendedBy returns the environments of the application that extend envName directly
+func (a *App) extendedBy(envName string) []*Env {
+	children := make([]*Env, 0)
+	if a.EnvType != "environment" {
+		return children
+	}
+	for _, env := range a.ListEnvs() {
+		if env != nil && env.Extends == envName {
+			children = append(children, env)
+		}
+	}
+	return children
+}
+
+func envNamesOf(envs []*Env) string {
+	names := make([]string, len(envs))
+	for i := range envs {
+		names[i] = envs[i].Name
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,137 @@
+package sellsword
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+const extendsDefinition = "type: environment\nvariables:\n  - access_key=AWS_ACCESS_KEY_ID\n" +
+	"  - secret_key=AWS_SECRET_ACCESS_KEY\n  - region=AWS_REGION\n  - role=AWS_ROLE\nsecrets:\n  - secret_key\n"
+
+// setUpExtendsApp makes acme-base, acme-dev extending it and acme-dev-eu extending acme-dev
+func setUpExtendsApp(t *testing.T) *App {
+	return setUpApp(t, "aws", extendsDefinition, map[string]string{
+		"acme":        acmeKeys["acme"],
+		"acme-base":   "access_key: AKIA\nsecret_key: hunter2\nregion: us-east-1\nrole: reader\n",
+		"acme-dev":    "extends: acme-base\nrole: developer\n",
+		"acme-dev-eu": "extends: acme-dev\nregion: eu-west-1\n",
+	})
+}
+
+func TestExtendsMergesParents(t *testing.T) {
+	setUpTest()
+	a := setUpExtendsApp(t)
+	env, err := a.NewEnv("acme-dev-eu")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := map[string]string{"access_key": "AKIA", "secret_key": "hunter2", "region": "eu-west-1",
+		"role": "developer"}
+	for k, v := range expected {
+		if env.Variables[k] != v {
+			t.Errorf("Expected %s to be %s, found %s", k, v, env.Variables[k])
+		}
+	}
+	if _, ok := env.Variables[extendsKey]; ok || env.Extends != "acme-dev" {
+		t.Errorf("Expected extends to name the parent rather than be a variable, found %v", env.Variables)
+	}
+	sources := map[string]string{"access_key": "acme-base", "region": "acme-dev-eu", "role": "acme-dev"}
+	for k, source := range sources {
+		if env.Source(k) != source {
+			t.Errorf("Expected %s to come from %s, found %s", k, source, env.Source(k))
+		}
+	}
+	env.PopulateExportVars()
+	if env.ExportVariables["AWS_ACCESS_KEY_ID"] != "AKIA" || env.ExportVariables["AWS_REGION"] != "eu-west-1" {
+		t.Errorf("Expected inherited and overridden values to be exported, found %v", env.ExportVariables)
+	}
+}
+
+func TestExtendsDetectsCycles(t *testing.T) {
+	setUpTest()
+	a := setUpExtendsApp(t)
+	ioutil.WriteFile(path.Join(a.Path, "acme-base"), []byte("extends: acme-dev-eu\naccess_key: AKIA\n"), 0644)
+	_, err := a.NewEnv("acme-dev")
+	if err == nil || !strings.Contains(err.Error(), "acme-dev -> acme-base -> acme-dev-eu -> acme-dev") {
+		t.Errorf("Expected the cycle to be reported, found %v", err)
+	}
+	ioutil.WriteFile(path.Join(a.Path, "acme-base"), []byte("extends: acme-gone\n"), 0644)
+	_, err = a.NewEnv("acme-dev")
+	if err == nil || !strings.Contains(err.Error(), "acme-base extends acme-gone, which does not exist") {
+		t.Errorf("Expected the missing parent to be reported, found %v", err)
+	}
+}
+
+func TestExtendsSaveKeepsInheritance(t *testing.T) {
+	setUpTest()
+	a := setUpExtendsApp(t)
+	if err := a.Set("acme-dev", map[string]string{"region": "us-west-2"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	d, _ := ioutil.ReadFile(path.Join(a.Path, "acme-dev"))
+	if string(d) != "extends: acme-base\nregion: us-west-2\nrole: developer\n" {
+		t.Errorf("Expected only the values acme-dev sets to be saved, found\n%s", d)
+	}
+	if err := a.Copy("acme-dev", "acme-qa", map[string]string{"role": "tester"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	d, _ = ioutil.ReadFile(path.Join(a.Path, "acme-qa"))
+	if string(d) != "extends: acme-base\nregion: us-west-2\nrole: tester\n" {
+		t.Errorf("Expected the copy to extend acme-base too, found\n%s", d)
+	}
+}
+
+func TestExtendedEnvsFollowTheirParent(t *testing.T) {
+	setUpTest()
+	a := setUpExtendsApp(t)
+	if _, err := a.Remove("acme-base", false); err == nil || !strings.Contains(err.Error(), "acme-dev") {
+		t.Errorf("Expected removing an extended environment to be refused, found %v", err)
+	}
+	ioutil.WriteFile(path.Join(a.Path, "acme-dev"), []byte("# developers\nrole: developer\n"+
+		"extends: acme-base # shared\n"), 0640)
+	os.Chmod(path.Join(a.Path, "acme-dev"), 0640)
+	if err := a.Move("acme-base", "acme-common"); err != nil {
+		t.Fatal(err.Error())
+	}
+	d, _ := ioutil.ReadFile(path.Join(a.Path, "acme-dev"))
+	if string(d) != "# developers\nrole: developer\nextends: acme-common # shared\n" {
+		t.Errorf("Expected only extends to change in acme-dev, found\n%s", d)
+	}
+	if fi, _ := os.Stat(path.Join(a.Path, "acme-dev")); fi == nil || fi.Mode().Perm() != 0640 {
+		t.Errorf("Expected acme-dev to keep its mode, found %v", fi)
+	}
+	env, err := a.NewEnv("acme-dev-eu")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if env.Source("access_key") != "acme-common" || env.Variables["access_key"] != "AKIA" {
+		t.Errorf("Expected acme-dev to extend acme-common, found %s from %s", env.Variables["access_key"],
+			env.Source("access_key"))
+	}
+}
+
+func TestMoveRollsBack(t *testing.T) {
+	setUpTest()
+	a := setUpExtendsApp(t)
+	ioutil.WriteFile(path.Join(a.Path, "acme-qa"), []byte("{extends: acme-base, role: tester}\n"), 0644)
+	if err := a.Link("acme-base"); err != nil {
+		t.Fatal(err.Error())
+	}
+	err := a.Move("acme-base", "acme-common")
+	if _, ok := err.(*RollbackError); !ok || !strings.Contains(err.Error(), "Could not point environment acme-qa") {
+		t.Fatalf("Expected the move to be rolled back, found %v", err)
+	}
+	if _, err := os.Stat(path.Join(a.Path, "acme-common")); !os.IsNotExist(err) {
+		t.Errorf("Expected acme-common to be renamed back, found %v", err)
+	}
+	if !linksTo(path.Join(a.Path, "current"), "acme-base") {
+		t.Errorf("Expected current to point at acme-base again")
+	}
+	d, _ := ioutil.ReadFile(path.Join(a.Path, "acme-dev"))
+	if string(d) != "extends: acme-base\nrole: developer\n" {
+		t.Errorf("Expected acme-dev to extend acme-base again, found\n%s", d)
+	}
+}
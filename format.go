@@ -0,0 +1,216 @@
+package sellsword
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// envFormats are the formats environment files can be written in, YAML by default
+var envFormats = []string{"yaml", "dotenv", "json", "toml"}
+
+var formatNames = map[string]string{"yaml": "YAML", "dotenv": "dotenv", "json": "JSON", "toml": "TOML"}
+
+var formatExtensions = map[string]string{".yml": "yaml", ".yaml": "yaml", ".env": "dotenv", ".json": "json",
+	".toml": "toml"}
+
+// formatOf returns the format of the environment envName, given by the extension
+// of its name or else by the application
+func (e *Env) formatOf(envName string) string {
+	if format, ok := formatExtensions[path.Ext(envName)]; ok {
+		return format
+	} else if e.Format != "" {
+		return e.Format
+	}
+	return "yaml"
+}
+
+// parseEnvFile reads the values of an environment file in format, keyed by
+// their dotted paths. How the values are written is recorded in layout unless it is nil
+func (e *Env) parseEnvFile(format string, data []byte, layout *envLayout) (map[string]string, error) {
+	if format == "dotenv" {
+		if layout != nil {
+			layout.lines = strings.Split(string(data), "\n")
+		}
+		return parseDotenv(string(data))
+	} else if format == "json" {
+		return flattenJson(data, e.separator, layout)
+	} else if format == "toml" {
+		values := make(map[string]string)
+		root, err := parseToml(string(data))
+		if err != nil {
+			return values, err
+		}
+		return values, root.flatten("", e.separator, values, layout)
+	}
+	return flattenYaml(data, e.separator, layout)
+}
+
+// formatEnvFile writes the values of keys in format, nested and as layout has
+// them, or over the lines of layout if the format is dotenv, with extends first
+// if the environment extends another
+func formatEnvFile(format string, extends string, keys []string, values map[string]string,
+	layout *envLayout) ([]byte, error) {
+	if format == "dotenv" {
+		var lines []string
+		if layout != nil {
+			lines = layout.lines
+		}
+		return formatDotenv(extends, keys, values, lines), nil
+	}
+	nested := nestVariables(keys, values, layout)
+	if extends != "" {
+		nested = append(yaml.MapSlice{{Key: extendsKey, Value: extends}}, nested...)
+	}
+	if format == "json" {
+		var out bytes.Buffer
+		writeJson(&out, nested, "")
+		out.WriteString("\n")
+		return out.Bytes(), nil
+	} else if format == "toml" {
+		var out bytes.Buffer
+		writeToml(&out, []string{}, nested)
+		return out.Bytes(), nil
+	}
+	return yaml.Marshal(nested)
+}
+
+// dotenvBare matches the values written to dotenv files without quotes
+var dotenvBare = regexp.MustCompile(`^[A-Za-z0-9_./:@,+=%-]*$`)
+
+// formatDotenv writes the values of keys over the lines the file had, keeping its
+// comments, blank lines and the assignments whose values are unchanged. Keys the
+// lines do not assign are appended, after extends if the file did not have it
+func formatDotenv(extends string, keys []string, values map[string]string, lines []string) []byte {
+	wanted := make(map[string]string, len(keys)+1)
+	for _, k := range keys {
+		wanted[k] = values[k]
+	}
+	if extends != "" {
+		wanted[extendsKey] = extends
+	}
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	written := make(map[string]bool)
+	var kept bytes.Buffer
+	for i, line := range lines {
+		a, err := parseDotenvLine(i+1, line)
+		if err != nil {
+			continue
+		} else if a == nil {
+			kept.WriteString(line + "\n")
+			continue
+		}
+		value, ok := wanted[a.key]
+		if !ok || written[a.key] {
+			continue
+		} else if value == a.value {
+			kept.WriteString(line + "\n")
+		} else {
+			kept.WriteString(a.prefix + dotenvQuote(value) + a.comment + "\n")
+		}
+		written[a.key] = true
+	}
+	var out bytes.Buffer
+	if extends != "" && !written[extendsKey] {
+		out.WriteString(extendsKey + "=" + dotenvQuote(extends) + "\n")
+	}
+	out.Write(kept.Bytes())
+	for _, k := range keys {
+		if !written[k] {
+			out.WriteString(k + "=" + dotenvQuote(values[k]) + "\n")
+		}
+	}
+	return out.Bytes()
+}
+
+// dotenvQuote quotes value so that dotenvValue reads it back as it is
+func dotenvQuote(value string) string {
+	if dotenvBare.MatchString(value) {
+		return value
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+	return `"` + replacer.Replace(value) + `"`
+}
+
+// flattenJson reads a JSON object of values, which may be nested, keeping
+// numbers as they are written
+func flattenJson(data []byte, separator func(string) string, layout *envLayout) (map[string]string, error) {
+	values := make(map[string]string)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var root map[string]interface{}
+	if err := decoder.Decode(&root); err != nil {
+		return values, err
+	}
+	return values, jsonNode(root).flatten("", separator, values, layout)
+}
+
+func jsonNode(value interface{}) envNode {
+	var n envNode
+	switch v := value.(type) {
+	case map[string]interface{}:
+		n.fields = make(map[string]envNode, len(v))
+		for k := range v {
+			n.fields[k] = jsonNode(v[k])
+		}
+	case []interface{}:
+		n.list = make([]envNode, len(v))
+		for i := range v {
+			n.list[i] = jsonNode(v[i])
+		}
+	case nil:
+		scalar := ""
+		n.scalar = &scalar
+	case string:
+		n.scalar = &v
+	default:
+		scalar := fmt.Sprintf("%v", v)
+		n.scalar, n.bare = &scalar, true
+	}
+	return n
+}
+
+// writeJson writes m as a JSON object, keeping the order of its keys
+func writeJson(out *bytes.Buffer, m yaml.MapSlice, indent string) {
+	if len(m) == 0 {
+		out.WriteString("{}")
+		return
+	}
+	out.WriteString("{\n")
+	for i, item := range m {
+		out.WriteString(indent + "  " + jsonString(fmt.Sprintf("%v", item.Key)) + ": ")
+		if sub, ok := item.Value.(yaml.MapSlice); ok {
+			writeJson(out, sub, indent+"  ")
+		} else if items, ok := item.Value.([]string); ok {
+			quoted := make([]string, len(items))
+			for j := range items {
+				quoted[j] = jsonString(items[j])
+			}
+			out.WriteString("[" + strings.Join(quoted, ", ") + "]")
+		} else if bare, ok := item.Value.(bareValue); ok {
+			out.WriteString(string(bare))
+		} else {
+			out.WriteString(jsonString(fmt.Sprintf("%v", item.Value)))
+		}
+		if i < len(m)-1 {
+			out.WriteString(",")
+		}
+		out.WriteString("\n")
+	}
+	out.WriteString(indent + "}")
+}
+
+// jsonString quotes s for JSON, leaving <, > and & alone
+func jsonString(s string) string {
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	return strings.TrimSuffix(out.String(), "\n")
+}
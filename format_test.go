@@ -0,0 +1,125 @@
+package sellsword
+
+import (
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestFormatOf(t *testing.T) {
+	env := &Env{}
+	expected := map[string]string{"acme": "yaml", "acme.yml": "yaml", "acme.env": "dotenv", "acme.json": "json",
+		"acme.toml": "toml"}
+	for name, format := range expected {
+		if env.formatOf(name) != format {
+			t.Errorf("Expected %s to be %s, found %s", name, format, env.formatOf(name))
+		}
+	}
+	env.Format = "dotenv"
+	if env.formatOf("acme") != "dotenv" || env.formatOf("acme.json") != "json" {
+		t.Errorf("Expected the format of the application unless the extension says otherwise")
+	}
+}
+
+func TestEnvFileFormats(t *testing.T) {
+	values := map[string]string{"aws.region": "eu-west-1", "aws.zones": "a,b", "name": `say "hi"` + "\n\\o/",
+		"port": "8080"}
+	keys := []string{"aws.region", "aws.zones", "name", "port"}
+	layout := &envLayout{lists: map[string][]string{"aws.zones": {"a", "b"}},
+		bare: map[string]string{"port": "8080"}}
+	expected := map[string]string{
+		"yaml":   "extends: base\naws:\n  region: eu-west-1\n  zones:\n  - a\n  - b\nname: |-\n  say \"hi\"\n  \\o/\nport: \"8080\"\n",
+		"dotenv": "extends=base\naws.region=eu-west-1\naws.zones=a,b\nname=\"say \\\"hi\\\"\\n\\\\o/\"\nport=8080\n",
+		"json": "{\n  \"extends\": \"base\",\n  \"aws\": {\n    \"region\": \"eu-west-1\",\n    \"zones\": [\"a\", \"b\"]\n  },\n" +
+			"  \"name\": \"say \\\"hi\\\"\\n\\\\o/\",\n  \"port\": 8080\n}\n",
+		"toml": "extends = \"base\"\nname = \"say \\\"hi\\\"\\n\\\\o/\"\nport = 8080\n\n[aws]\n" +
+			"region = \"eu-west-1\"\nzones = [\"a\", \"b\"]\n",
+	}
+	env := &Env{}
+	for _, format := range envFormats {
+		d, err := formatEnvFile(format, "base", keys, values, layout)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if string(d) != expected[format] {
+			t.Errorf("Expected %s\n%s\nfound\n%s", format, expected[format], d)
+		}
+		read, err := env.parseEnvFile(format, d, nil)
+		if err != nil {
+			t.Fatalf("Expected %s to read back, found %v", format, err)
+		}
+		if read[extendsKey] != "base" {
+			t.Errorf("Expected extends to read back from %s, found %v", format, read)
+		}
+		for k, v := range values {
+			if read[k] != v {
+				t.Errorf("Expected %s to read back from %s as %q, found %q", k, format, v, read[k])
+			}
+		}
+	}
+}
+
+func TestJsonKeepsNumbers(t *testing.T) {
+	values, err := flattenJson([]byte(`{"version": 1.10, "big": 12345678901234567890, "on": true, "off": null,
+		"hosts": ["a", "b"]}`), func(string) string { return ":" }, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := map[string]string{"version": "1.10", "big": "12345678901234567890", "on": "true", "off": "",
+		"hosts": "a:b"}
+	for k, v := range expected {
+		if values[k] != v {
+			t.Errorf("Expected %s to be %s, found %s", k, v, values[k])
+		}
+	}
+}
+
+func TestEnvironmentInAppFormat(t *testing.T) {
+	setUpTest()
+	a := setUpApp(t, "aws", "type: environment\nformat: dotenv\nvariables:\n  - access_key=AWS_ACCESS_KEY_ID\n"+
+		"  - secret_key=AWS_SECRET_ACCESS_KEY\n", acmeKeys)
+	ioutil.WriteFile(path.Join(a.Path, "acme"), []byte("# from the customer\nexport access_key=AKIA\n"+
+		"secret_key='hunter 2'\n"), 0644)
+	ioutil.WriteFile(path.Join(a.Path, "megacorp.json"), []byte(`{"extends": "acme", "access_key": "AKIB"}`), 0644)
+	env, err := a.NewEnv("megacorp.json")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if env.Variables["access_key"] != "AKIB" || env.Variables["secret_key"] != "hunter 2" {
+		t.Errorf("Expected a JSON environment extending a dotenv one, found %v", env.Variables)
+	}
+	if err := a.Set("acme", map[string]string{"access_key": "AKIC"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	d, _ := ioutil.ReadFile(path.Join(a.Path, "acme"))
+	if string(d) != "# from the customer\nexport access_key=AKIC\nsecret_key='hunter 2'\n" {
+		t.Errorf("Expected acme to be saved as dotenv keeping its comment and export, found\n%s", d)
+	}
+	ioutil.WriteFile(a.Definition, []byte("type: environment\nformat: ini\nvariables:\n"+
+		"  - access_key=AWS_ACCESS_KEY_ID\n"), 0644)
+	if _, err := NewApp("aws", a.Home); err == nil || !strings.Contains(err.Error(), "Format ini") {
+		t.Errorf("Expected an unknown format to be refused, found %v", err)
+	}
+}
+
+func TestSetKeepsScalarTypes(t *testing.T) {
+	setUpTest()
+	a := setUpApp(t, "aws", "type: environment\nvariables:\n  - access_key=AWS_ACCESS_KEY_ID\n"+
+		"  - port=PORT\n  - debug=DEBUG\n  - since=SINCE\n", acmeKeys)
+	files := map[string][2]string{
+		"megacorp.json": {"{\n  \"access_key\": \"AKIA\",\n  \"debug\": true,\n  \"port\": 8080\n}\n",
+			"{\n  \"access_key\": \"AKIB\",\n  \"debug\": true,\n  \"port\": 8080\n}\n"},
+		"megacorp.toml": {"access_key = \"AKIA\"\ndebug = true\nport = 8080\nsince = 1979-05-27\n",
+			"access_key = \"AKIB\"\ndebug = true\nport = 8080\nsince = 1979-05-27\n"},
+	}
+	for name, contents := range files {
+		ioutil.WriteFile(path.Join(a.Path, name), []byte(contents[0]), 0644)
+		if err := a.Set(name, map[string]string{"access_key": "AKIB"}); err != nil {
+			t.Fatal(err.Error())
+		}
+		if d, _ := ioutil.ReadFile(path.Join(a.Path, name)); string(d) != contents[1] {
+			t.Errorf("Expected %s to keep the types of unchanged values\n%s\nfound\n%s", name, contents[1], d)
+		}
+	}
+}
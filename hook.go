@@ -0,0 +1,67 @@
+package sellsword
+
+import (
+	"fmt"
+)
+
+// posixHook defines the ssw function for bash, zsh and sh. The binary writes the
+// statements meant for the shell to the file named by SSW_EVAL_FILE, so whatever
+// it prints to the terminal is never evaluated. sh has no local variables, so
+// the function unsets its own before returning
+const posixHook = `ssw() {
+    __ssw_eval="$(mktemp)" || { unset __ssw_eval; return 1; }
+    SSW_HOOK=%s SSW_EVAL_FILE="$__ssw_eval" command sellsword "$@"
+    __ssw_status=$?
+    if [ -s "$__ssw_eval" ]; then
+        . "$__ssw_eval"
+    fi
+    rm -f "$__ssw_eval"
+    unset __ssw_eval
+    eval "unset __ssw_status; return $__ssw_status"
+}
+`
+
+const fishHook = `function ssw
+    set -l __ssw_eval (mktemp)
+    or return $status
+    env SSW_HOOK=fish SSW_EVAL_FILE=$__ssw_eval sellsword $argv
+    set -l __ssw_status $status
+    if test -s $__ssw_eval
+        source $__ssw_eval
+    end
+    rm -f $__ssw_eval
+    return $__ssw_status
+end
+`
+
+// Session mode keys the selections of each terminal on the pid of its shell
+const posixSessionHook = "SSW_SESSION=$$; export SSW_SESSION\n"
+
+const fishSessionHook = "set -gx SSW_SESSION $fish_pid\n"
+
+func makePosixHook(sh Shell, session bool) string {
+	hook := fmt.Sprintf(posixHook, sh.Name())
+	if session {
+		return posixSessionHook + hook
+	}
+	return hook
+}
+
+func (s bashShell) Hook(session bool) string {
+	return makePosixHook(s, session)
+}
+
+func (s zshShell) Hook(session bool) string {
+	return makePosixHook(s, session)
+}
+
+func (s posixShell) Hook(session bool) string {
+	return makePosixHook(s, session)
+}
+
+func (s fishShell) Hook(session bool) string {
+	if session {
+		return fishSessionHook + fishHook
+	}
+	return fishHook
+}
@@ -0,0 +1,130 @@
+package sellsword
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+)
+
+// write a fake sellsword binary that prints stdout and writes statements to the
+// eval file passed by the hook
+func writeFakeSellsword(t *testing.T, dir string, stdout string, statements string) {
+	script := "#!/bin/sh\ncat <<'EOF'\n" + stdout + "\nEOF\ncat > \"$SSW_EVAL_FILE\" <<'EOF'\n" +
+		statements + "\nEOF\n"
+	if err := ioutil.WriteFile(path.Join(dir, "sellsword"), []byte(script), 0755); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+func runHook(t *testing.T, sh Shell, dir string, script string) string {
+	cmd := exec.Command("/bin/sh", "-c", sh.Hook(false)+script)
+	cmd.Env = append(os.Environ(), "PATH="+dir+":"+os.Getenv("PATH"))
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("Running %s hook failed: %s", sh.Name(), err.Error())
+	}
+	return string(out)
+}
+
+func TestHookEvaluatesEvalFile(t *testing.T) {
+	tmp := setUpTest()
+	dir := path.Join(tmp, "hook")
+	os.MkdirAll(dir, 0755)
+	defer os.RemoveAll(dir)
+	writeFakeSellsword(t, dir, "", (posixShell{}).Export("REGION", "us east"))
+	actual := runHook(t, posixShell{}, dir, "ssw use aws acme\nprintf %s \"$REGION\"")
+	if actual != "\nus east" {
+		t.Errorf("Expected hook to evaluate statements from eval file, found %s", actual)
+	}
+}
+
+func TestHookDoesNotEvaluateStdout(t *testing.T) {
+	tmp := setUpTest()
+	dir := path.Join(tmp, "hook")
+	os.MkdirAll(dir, 0755)
+	defer os.RemoveAll(dir)
+	writeFakeSellsword(t, dir, "export REGION=nowhere", "")
+	actual := runHook(t, posixShell{}, dir, "ssw list\nprintf %s \"$REGION\"")
+	if strings.TrimSpace(actual) != "export REGION=nowhere" {
+		t.Errorf("Expected hook to print stdout without evaluating it, found %s", actual)
+	}
+}
+
+func TestHookLeavesNoVariables(t *testing.T) {
+	tmp := setUpTest()
+	dir := path.Join(tmp, "hook")
+	os.MkdirAll(dir, 0755)
+	defer os.RemoveAll(dir)
+	writeFakeSellsword(t, dir, "", "")
+	script := "ssw list\necho $? ${__ssw_eval-unset} ${__ssw_status-unset}"
+	for _, sh := range []Shell{posixShell{}, bashShell{}, zshShell{}} {
+		shell, err := exec.LookPath(sh.Name())
+		if err != nil {
+			continue
+		}
+		cmd := exec.Command(shell, "-c", sh.Hook(false)+script)
+		cmd.Env = append(os.Environ(), "PATH="+dir+":"+os.Getenv("PATH"))
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("Running %s hook failed: %s", sh.Name(), err.Error())
+		}
+		if !strings.HasSuffix(string(out), "0 unset unset\n") {
+			t.Errorf("Expected %s hook to leave no variables behind, found %s", sh.Name(), out)
+		}
+	}
+}
+
+func TestFishHook(t *testing.T) {
+	tmp := setUpTest()
+	hook := (fishShell{}).Hook(false)
+	lines := strings.Split(hook, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	for _, line := range []string{"function ssw", "env SSW_HOOK=fish SSW_EVAL_FILE=$__ssw_eval sellsword $argv",
+		"if test -s $__ssw_eval", "source $__ssw_eval", "rm -f $__ssw_eval", "return $__ssw_status"} {
+		if !contains(lines, line) {
+			t.Errorf("Expected fish hook to contain the line %s, found %s", line, hook)
+		}
+	}
+	fish, err := exec.LookPath("fish")
+	if err != nil {
+		t.Skip("fish is not installed")
+	}
+	dir := path.Join(tmp, "hook")
+	os.MkdirAll(dir, 0755)
+	defer os.RemoveAll(dir)
+	writeFakeSellsword(t, dir, "export REGION=nowhere", (fishShell{}).Export("REGION", "us east"))
+	cmd := exec.Command(fish, "--no-config", "-c", hook+"ssw use aws acme\nprintf %s $REGION")
+	cmd.Env = append(os.Environ(), "PATH="+dir+":"+os.Getenv("PATH"))
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("Running fish hook failed: %s", err.Error())
+	}
+	if string(out) != "export REGION=nowhere\nus east" {
+		t.Errorf("Expected fish hook to evaluate only the eval file, found %s", out)
+	}
+}
+
+func TestSessionHook(t *testing.T) {
+	tmp := setUpTest()
+	dir := path.Join(tmp, "hook")
+	os.MkdirAll(dir, 0755)
+	defer os.RemoveAll(dir)
+	writeFakeSellsword(t, dir, "", "")
+	cmd := exec.Command("/bin/sh", "-c", (posixShell{}).Hook(true)+"echo $$ $SSW_SESSION")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	ids := strings.Fields(string(out))
+	if len(ids) != 2 || ids[0] != ids[1] {
+		t.Errorf("Expected session hook to set SSW_SESSION to the pid of the shell, found %s", string(out))
+	}
+	if strings.Contains((bashShell{}).Hook(false), "SSW_SESSION=") {
+		t.Error("Expected hook without session mode not to set SSW_SESSION")
+	}
+}
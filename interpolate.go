@@ -0,0 +1,104 @@
+package sellsword
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// interpolator resolves the references in the values of one environment,
+// remembering the keys it is resolving to catch values that refer to each other
+type interpolator struct {
+	env      *Env
+	raw      map[string]string
+	resolved map[string]string
+	chain    []string
+}
+
+// interpolate returns vars with every reference resolved. Values may refer to
+//
+//	${key}          another variable of the environment
+//	${env:NAME}     the environment variable NAME of the shell
+//	${SSW_CURRENT}  the path of the environment, as load and unload actions see it
+//
+// Only ${ is special. $${ stands for a literal ${, and a ${ without a closing }
+// is kept as it is, so that values written before references existed still load
+func (e *Env) interpolate(vars map[string]string) (map[string]string, error) {
+	in := &interpolator{env: e, raw: vars, resolved: make(map[string]string, len(vars))}
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	// sorted so that the same problem is reported every time
+	sort.Strings(keys)
+	for _, k := range keys {
+		if _, err := in.resolve(k); err != nil {
+			return in.resolved, err
+		}
+	}
+	return in.resolved, nil
+}
+
+func (in *interpolator) resolve(key string) (string, error) {
+	if value, ok := in.resolved[key]; ok {
+		return value, nil
+	}
+	if contains(in.chain, key) {
+		return "", errors.New(fmt.Sprintf("Variables of environment %s refer to each other: %s", in.env.Name,
+			strings.Join(append(in.chain, key), " -> ")))
+	}
+	in.chain = append(in.chain, key)
+	defer func() { in.chain = in.chain[:len(in.chain)-1] }()
+	raw := in.raw[key]
+	var out bytes.Buffer
+	for i := 0; i < len(raw); i++ {
+		if strings.HasPrefix(raw[i:], "$${") {
+			out.WriteString("${")
+			i += 2
+			continue
+		}
+		if !strings.HasPrefix(raw[i:], "${") {
+			out.WriteByte(raw[i])
+			continue
+		}
+		end := strings.IndexByte(raw[i+2:], '}')
+		if end < 0 {
+			out.WriteString(raw[i:])
+			break
+		}
+		ref := raw[i+2 : i+2+end]
+		value, err := in.lookup(key, ref)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(value)
+		i += end + 2
+	}
+	in.resolved[key] = out.String()
+	return in.resolved[key], nil
+}
+
+// lookup returns the value of the reference ref found in the value of key
+func (in *interpolator) lookup(key string, ref string) (string, error) {
+	if ref == "SSW_CURRENT" {
+		return in.env.Path, nil
+	} else if strings.HasPrefix(ref, "env:") {
+		if value, ok := os.LookupEnv(strings.TrimPrefix(ref, "env:")); ok {
+			return value, nil
+		}
+		return "", errors.New(fmt.Sprintf("Cannot resolve ${%s} in %s of environment %s, %s is not set",
+			ref, key, in.env.Name, strings.TrimPrefix(ref, "env:")))
+	} else if _, ok := in.raw[ref]; ok {
+		return in.resolve(ref)
+	}
+	return "", errors.New(fmt.Sprintf("Cannot resolve ${%s} in %s of environment %s, it has no variable %s",
+		ref, key, in.env.Name, ref))
+}
+
+// Resolved returns the variables of the environment with every reference resolved
+func (e *Env) Resolved() (map[string]string, error) {
+	return e.interpolate(e.Variables)
+}
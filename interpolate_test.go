@@ -0,0 +1,83 @@
+package sellsword
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	env := &Env{Name: "acme", Path: "/home/ssw/aws/acme"}
+	os.Setenv("SSW_TEST_USER", "bryan")
+	defer os.Unsetenv("SSW_TEST_USER")
+	resolved, err := env.interpolate(map[string]string{
+		"region":   "eu-west-1",
+		"endpoint": "https://${region}.acme.internal",
+		"url":      "${endpoint}/${env:SSW_TEST_USER}",
+		"config":   "${SSW_CURRENT}/config",
+		"price":    "$$5 or $6 or $",
+		"escaped":  "$${region} is ${region}",
+		"legacy":   "x${y",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := map[string]string{
+		"endpoint": "https://eu-west-1.acme.internal",
+		"url":      "https://eu-west-1.acme.internal/bryan",
+		"config":   "/home/ssw/aws/acme/config",
+		"price":    "$$5 or $6 or $",
+		"escaped":  "${region} is eu-west-1",
+		"legacy":   "x${y",
+	}
+	for k, v := range expected {
+		if resolved[k] != v {
+			t.Errorf("Expected %s to be %s, found %s", k, v, resolved[k])
+		}
+	}
+}
+
+func TestInterpolateErrors(t *testing.T) {
+	env := &Env{Name: "acme"}
+	os.Unsetenv("SSW_TEST_UNSET")
+	cases := map[string]map[string]string{
+		"Variables of environment acme refer to each other: a -> b -> c -> a":      {"a": "${b}", "b": "x${c}", "c": "${a}"},
+		"Cannot resolve ${nope} in a of environment acme, it has no variable nope": {"a": "${nope}"},
+		"Cannot resolve ${env:SSW_TEST_UNSET} in a of environment acme":            {"a": "${env:SSW_TEST_UNSET}"},
+	}
+	for expected, vars := range cases {
+		if _, err := env.interpolate(vars); err == nil || !strings.HasPrefix(err.Error(), expected) {
+			t.Errorf("Expected error %s, found %v", expected, err)
+		}
+	}
+}
+
+func TestInterpolatedValuesAreExported(t *testing.T) {
+	setUpTest()
+	a := setUpExtendsApp(t)
+	ioutil.WriteFile(path.Join(a.Path, "acme-dev"), []byte("extends: acme-base\nrole: ${region}-dev\n"), 0644)
+	env, _ := a.NewEnv("acme-dev")
+	if err := env.Validate(); err != nil {
+		t.Fatal(err.Error())
+	}
+	env.PopulateExportVars()
+	if env.ExportVariables["AWS_ROLE"] != "us-east-1-dev" {
+		t.Errorf("Expected AWS_ROLE to be us-east-1-dev, found %s", env.ExportVariables["AWS_ROLE"])
+	}
+	if value, _ := a.Get("acme-dev", "role"); value != "us-east-1-dev" {
+		t.Errorf("Expected get to resolve references, found %s", value)
+	}
+	// the reference is kept when the environment is saved
+	a.Set("acme-dev", map[string]string{"region": "eu-west-1"})
+	d, _ := ioutil.ReadFile(path.Join(a.Path, "acme-dev"))
+	if !strings.Contains(string(d), "role: ${region}-dev") {
+		t.Errorf("Expected the reference to be saved as it is, found\n%s", d)
+	}
+	ioutil.WriteFile(path.Join(a.Path, "acme-dev"), []byte("extends: acme-base\nrole: ${missing}\n"), 0644)
+	env, _ = a.NewEnv("acme-dev")
+	if err := env.Validate(); err == nil || !strings.Contains(err.Error(), "${missing}") {
+		t.Errorf("Expected the unresolved reference to be reported, found %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package sellsword
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"syscall"
+)
+
+// lock takes an advisory lock on the application so that only one process at a
+// time switches its environment. The lock is released by calling the returned
+// function, or by the kernel if the process dies
+func (a *App) lock() (func(), error) {
+	dir := path.Join(a.Home, ".locks")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return func() {}, err
+	}
+	f, err := os.OpenFile(path.Join(dir, a.Name+".lock"), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return func() {}, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return func() {}, errors.New(fmt.Sprintf("Another sellsword process is switching the environment "+
+				"of application %s, try again when it is done", a.Name))
+		}
+		return func() {}, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// replaceSymlink points link at source in a single step by creating the new
+// symlink under a temporary name next to link and renaming it into place, so
+// that link is never missing or half written
+func replaceSymlink(source string, link string) error {
+	tmp := path.Join(path.Dir(link), fmt.Sprintf(".%s.ssw-%d", path.Base(link), os.Getpid()))
+	os.Remove(tmp)
+	if err := os.Symlink(source, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package sellsword
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMakeCurrentFailsWhileLocked(t *testing.T) {
+	setUpTest()
+	wd, _ := os.Getwd()
+	relink(path.Join(wd, "test/aws/dyncorp"), path.Join(wd, "test/aws/current"))
+	a, _ := NewApp("aws", path.Join(wd, "test"))
+	defer os.RemoveAll(path.Join(a.Home, ".locks"))
+	unlock, err := a.lock()
+	if err != nil {
+		t.Fatalf("Expected to take lock, received error %s", err.Error())
+	}
+	err = a.MakeCurrent("acme")
+	if err == nil || !strings.Contains(err.Error(), "Another sellsword process") {
+		t.Errorf("Expected MakeCurrent to fail while locked, received %v", err)
+	}
+	if source, _ := os.Readlink(path.Join(wd, "test/aws/current")); source != path.Join(wd, "test/aws/dyncorp") {
+		t.Errorf("Expected current to be untouched while locked, found %s", source)
+	}
+	unlock()
+	if err := a.MakeCurrent("acme"); err != nil {
+		t.Errorf("Expected MakeCurrent to succeed after unlock, received error %s", err.Error())
+	}
+}
+
+func TestReplaceSymlink(t *testing.T) {
+	tmp := setUpTest()
+	link := path.Join(tmp, "replace-link")
+	os.Remove(link)
+	defer os.Remove(link)
+	for _, source := range []string{"/first", "/second"} {
+		if err := replaceSymlink(source, link); err != nil {
+			t.Fatalf("Expected symlink to be replaced, received error %s", err.Error())
+		}
+		if actual, _ := os.Readlink(link); actual != source {
+			t.Errorf("Expected %s to point at %s, found %s", link, source, actual)
+		}
+	}
+	entries, _ := ioutil.ReadDir(tmp)
+	for i := range entries {
+		if strings.HasPrefix(entries[i].Name(), ".replace-link") {
+			t.Errorf("Expected temporary symlink to be renamed away, found %s", entries[i].Name())
+		}
+	}
+}
+
+func TestEditFailsWhileLocked(t *testing.T) {
+	tmp := setUpTest()
+	a := setUpApp(t, "aws", schemaDefinition, nil)
+	ioutil.WriteFile(path.Join(a.Path, "dev"), []byte("access_key: AKIA\nregion: us-east-1\ntier: dev\n"), 0644)
+	defer setUpEditor(t, tmp, "access_key: AKIA\nregion: eu-west-1\ntier: dev\n")()
+	unlock, err := a.lock()
+	if err != nil {
+		t.Fatalf("Expected to take lock, received error %s", err.Error())
+	}
+	defer unlock()
+	if err := a.Edit("dev"); err == nil || !strings.Contains(err.Error(), "Another sellsword process") {
+		t.Errorf("Expected Edit to fail while locked, received %v", err)
+	}
+	if d, _ := ioutil.ReadFile(path.Join(a.Path, "dev")); !strings.Contains(string(d), "us-east-1") {
+		t.Errorf("Expected env to be untouched while locked, found %s", d)
+	}
+}
+
+func TestSetFailsWhileLocked(t *testing.T) {
+	setUpTest()
+	a := setUpApp(t, "aws", "type: environment\nvariables:\n  - access_key=AWS_ACCESS_KEY_ID\n"+
+		"  - secret_key=AWS_SECRET_ACCESS_KEY\n", acmeKeys)
+	unlock, err := a.lock()
+	if err != nil {
+		t.Fatalf("Expected to take lock, received error %s", err.Error())
+	}
+	if err := a.Set("acme", map[string]string{"access_key": "AKIB"}); err == nil ||
+		!strings.Contains(err.Error(), "Another sellsword process") {
+		t.Errorf("Expected Set to fail while locked, received %v", err)
+	}
+	unlock()
+	if err := a.Set("acme", map[string]string{"access_key": "AKIB"}); err != nil {
+		t.Errorf("Expected Set to succeed after unlock, received error %s", err.Error())
+	}
+}
+
+func TestRemoveFailsWhileLocked(t *testing.T) {
+	setUpTest()
+	a := setUpRollbackApp(t)
+	unlock, err := a.lock()
+	if err != nil {
+		t.Fatalf("Expected to take lock, received error %s", err.Error())
+	}
+	if _, err := a.Remove("good", false); err == nil || !strings.Contains(err.Error(), "Another sellsword process") {
+		t.Errorf("Expected Remove to fail while locked, received %v", err)
+	}
+	if _, err := os.Stat(path.Join(a.Path, "good")); err != nil {
+		t.Errorf("Expected good to be untouched while locked, found %v", err)
+	}
+	unlock()
+}
+
+func TestCopyFailsWhileLocked(t *testing.T) {
+	setUpTest()
+	a := setUpRollbackApp(t)
+	unlock, err := a.lock()
+	if err != nil {
+		t.Fatalf("Expected to take lock, received error %s", err.Error())
+	}
+	defer unlock()
+	if err := a.Copy("good", "better", map[string]string{}); err == nil ||
+		!strings.Contains(err.Error(), "Another sellsword process") {
+		t.Errorf("Expected Copy to fail while locked, received %v", err)
+	}
+	if _, err := os.Lstat(path.Join(a.Path, "better")); err == nil {
+		t.Error("Expected better not to be created while locked")
+	}
+}
+
+func TestMakeSessionCurrentFailsWhileLocked(t *testing.T) {
+	setUpTest()
+	a := setUpApp(t, "aws", "type: environment\nvariables:\n  - access_key=AWS_ACCESS_KEY_ID\n", acmeKeys)
+	a.Session = strconv.Itoa(os.Getpid())
+	unlock, err := a.lock()
+	if err != nil {
+		t.Fatalf("Expected to take lock, received error %s", err.Error())
+	}
+	defer unlock()
+	if err := a.MakeSessionCurrent("acme"); err == nil || !strings.Contains(err.Error(), "Another sellsword process") {
+		t.Errorf("Expected MakeSessionCurrent to fail while locked, received %v", err)
+	}
+	if _, err := os.Lstat(sessionsDir(a.Home)); err == nil {
+		t.Error("Expected no session to be made while locked")
+	}
+}
@@ -0,0 +1,61 @@
+package sellsword
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// Mapping links Source, a file or directory inside an environment, to Target.
+// A Source of "." stands for the whole environment
+type Mapping struct {
+	Source string
+	Target string
+}
+
+// parseMapping parses an entry of the targets list of the form source -> target
+func parseMapping(entry string) (Mapping, error) {
+	var m Mapping
+	sourceTarget := strings.SplitN(entry, "->", 2)
+	if len(sourceTarget) != 2 {
+		return m, errors.New(fmt.Sprintf("Target %s is not of the form source -> target", entry))
+	}
+	source := path.Clean(strings.TrimSpace(sourceTarget[0]))
+	target := strings.TrimSpace(sourceTarget[1])
+	if source == ".." || strings.HasPrefix(source, "../") || path.IsAbs(source) {
+		return m, errors.New(fmt.Sprintf("Source %s of target %s must be inside the environment", source, entry))
+	}
+	if target == "" {
+		return m, errors.New(fmt.Sprintf("Target %s has no target path", entry))
+	}
+	if expanded, err := expandPath(target); err != nil {
+		return m, err
+	} else {
+		m.Source = source
+		m.Target = expanded
+		return m, nil
+	}
+}
+
+// check reports an error if the Source does not exist inside envPath
+func (m Mapping) check(envPath string) error {
+	source := path.Join(envPath, m.Source)
+	if _, err := os.Stat(source); err != nil {
+		return errors.New(fmt.Sprintf("Cannot link %s to %s: %s", source, m.Target, err.Error()))
+	}
+	return nil
+}
+
+// link points Target at the Source inside envPath, creating the parent
+// directories of Target as needed
+func (m Mapping) link(envPath string) error {
+	if err := m.check(envPath); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(m.Target), 0755); err != nil {
+		return err
+	}
+	return replaceSymlink(path.Join(envPath, m.Source), m.Target)
+}
@@ -0,0 +1,31 @@
+package sellsword
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestParseMapping(t *testing.T) {
+	setUpTest()
+	wd, _ := os.Getwd()
+	m, err := parseMapping("kube/config -> ./fixtures/kube/config")
+	if err != nil {
+		t.Fatalf("Expected mapping to parse, received error %s", err.Error())
+	}
+	if m.Source != "kube/config" {
+		t.Errorf("Expected source to be kube/config, found %s", m.Source)
+	}
+	if expected := path.Join(wd, "fixtures/kube/config"); m.Target != expected {
+		t.Errorf("Expected target to be %s, found %s", expected, m.Target)
+	}
+}
+
+func TestParseMappingInvalid(t *testing.T) {
+	setUpTest()
+	for _, entry := range []string{"config ~/.kube/config", "../escape -> ~/.kube", "/etc -> ~/.etc", "config -> "} {
+		if _, err := parseMapping(entry); err == nil {
+			t.Errorf("Expected error parsing mapping %s but did not receive one", entry)
+		}
+	}
+}
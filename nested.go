@@ -0,0 +1,191 @@
+package sellsword
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"sort"
+	"strings"
+)
+
+// defaultSeparator joins the items of lists in environment files
+const defaultSeparator = ","
+
+// envNode is a value in an environment file: a scalar, a list or a map. Scalars
+// keep their text, so that 1.10 stays 1.10 rather than becoming a number. bare
+// marks scalars such as numbers and booleans that JSON and TOML write unquoted
+type envNode struct {
+	scalar *string
+	bare   bool
+	list   []envNode
+	fields map[string]envNode
+}
+
+// envLayout records how an environment file writes its values, so that Save can
+// write the values that have not changed the same way again
+type envLayout struct {
+	// lists holds the items of the values written as lists
+	lists map[string][]string
+	// bare holds the values written without quotes
+	bare map[string]string
+	// lines holds the lines of a dotenv file, with its comments and exports
+	lines []string
+}
+
+func newEnvLayout() *envLayout {
+	return &envLayout{lists: make(map[string][]string), bare: make(map[string]string)}
+}
+
+// bareValue is a value written without quotes, as it was read
+type bareValue string
+
+// value returns what to write for value at key: its items if it is a list, a
+// bareValue if it is written without quotes, or else the value itself
+func (l *envLayout) value(key string, value string) interface{} {
+	if l == nil {
+		return value
+	} else if items, ok := l.lists[key]; ok {
+		return items
+	} else if _, ok := l.bare[key]; ok {
+		return bareValue(value)
+	}
+	return value
+}
+
+func (n *envNode) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var scalar string
+	if err := unmarshal(&scalar); err == nil {
+		n.scalar = &scalar
+		return nil
+	}
+	if err := unmarshal(&n.list); err == nil {
+		return nil
+	}
+	n.list = nil
+	return unmarshal(&n.fields)
+}
+
+// flatten adds the values below node to values, keyed by their dotted path.
+// Lists of scalars are joined with the separator for their path. Lists and bare
+// values are recorded in layout unless it is nil
+func (n envNode) flatten(key string, separator func(string) string, values map[string]string,
+	layout *envLayout) error {
+	if n.scalar != nil {
+		values[key] = *n.scalar
+		if n.bare && layout != nil {
+			layout.bare[key] = *n.scalar
+		}
+	} else if n.list != nil {
+		items := make([]string, len(n.list))
+		for i := range n.list {
+			if n.list[i].scalar == nil {
+				return errors.New(fmt.Sprintf("%s is a list of lists or maps, lists can only hold values", key))
+			}
+			items[i] = *n.list[i].scalar
+		}
+		values[key] = strings.Join(items, separator(key))
+		if layout != nil {
+			layout.lists[key] = items
+		}
+	} else {
+		for k, child := range n.fields {
+			if err := child.flatten(joinPath(key, k), separator, values, layout); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func joinPath(prefix string, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// flattenYaml reads a YAML map of values, which may be nested, into a map keyed by
+// dotted paths such as aws.prod.region
+func flattenYaml(data []byte, separator func(string) string, layout *envLayout) (map[string]string, error) {
+	values := make(map[string]string)
+	var root map[string]envNode
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return values, err
+	}
+	return values, envNode{fields: root}.flatten("", separator, values, layout)
+}
+
+// separator returns what joins the items of the list at key, set by the
+// variable or else by the application
+func (e *Env) separator(key string) string {
+	if v, ok := e.Schema[key]; ok && v.Separator != "" {
+		return v.Separator
+	} else if e.Separator != "" {
+		return e.Separator
+	}
+	return defaultSeparator
+}
+
+// nestVariables turns the dotted keys of values back into nested maps, in the
+// order of keys, writing the values layout has as lists or bare values that way.
+// Keys that clash with a value at a shorter path stay dotted
+func nestVariables(keys []string, values map[string]string, layout *envLayout) yaml.MapSlice {
+	sort.Strings(keys)
+	nested := yaml.MapSlice{}
+	for _, k := range keys {
+		value := layout.value(k, values[k])
+		if !insertPath(&nested, strings.Split(k, "."), value) {
+			nested = append(nested, yaml.MapItem{Key: k, Value: value})
+		}
+	}
+	return nested
+}
+
+// savedLayout returns the part of the layout of the environment file that Save
+// keeps, which is the lists and bare values that have not changed since the file
+// was read
+func (e *Env) savedLayout() *envLayout {
+	layout := newEnvLayout()
+	if e.layout == nil {
+		return layout
+	}
+	layout.lines = e.layout.lines
+	for k, items := range e.layout.lists {
+		if value, ok := e.Variables[k]; ok && value == strings.Join(items, e.separator(k)) {
+			layout.lists[k] = items
+		}
+	}
+	for k, bare := range e.layout.bare {
+		if value, ok := e.Variables[k]; ok && value == bare {
+			layout.bare[k] = bare
+		}
+	}
+	return layout
+}
+
+func insertPath(m *yaml.MapSlice, parts []string, value interface{}) bool {
+	if parts[0] == "" {
+		return false
+	}
+	for i := range *m {
+		if (*m)[i].Key != parts[0] {
+			continue
+		}
+		sub, ok := (*m)[i].Value.(yaml.MapSlice)
+		if len(parts) == 1 || !ok || !insertPath(&sub, parts[1:], value) {
+			return false
+		}
+		(*m)[i].Value = sub
+		return true
+	}
+	if len(parts) == 1 {
+		*m = append(*m, yaml.MapItem{Key: parts[0], Value: value})
+		return true
+	}
+	sub := yaml.MapSlice{}
+	if !insertPath(&sub, parts[1:], value) {
+		return false
+	}
+	*m = append(*m, yaml.MapItem{Key: parts[0], Value: sub})
+	return true
+}
@@ -0,0 +1,107 @@
+package sellsword
+
+import (
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+)
+
+const nestedDefinition = `type: environment
+separator: ' '
+variables:
+  - aws.prod.region=AWS_REGION
+  - aws.prod.zones=AWS_ZONES
+  - key: hosts
+    env: HOSTS
+    separator: ':'
+  - version=VERSION
+`
+
+const nestedEnv = `aws:
+  prod:
+    region: eu-west-1
+    zones: [eu-west-1a, eu-west-1b]
+hosts:
+  - alpha
+  - beta
+version: 1.10
+`
+
+func TestFlattenYaml(t *testing.T) {
+	values, err := flattenYaml([]byte(nestedEnv), func(key string) string { return "," }, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := map[string]string{"aws.prod.region": "eu-west-1", "aws.prod.zones": "eu-west-1a,eu-west-1b",
+		"hosts": "alpha,beta", "version": "1.10"}
+	if len(values) != len(expected) {
+		t.Errorf("Expected %v, found %v", expected, values)
+	}
+	for k, v := range expected {
+		if values[k] != v {
+			t.Errorf("Expected %s to be %s, found %s", k, v, values[k])
+		}
+	}
+	_, err = flattenYaml([]byte("servers:\n  - host: alpha\n"), func(key string) string { return "," }, nil)
+	if err == nil || !strings.Contains(err.Error(), "servers is a list of lists or maps") {
+		t.Errorf("Expected a list of maps to be refused, found %v", err)
+	}
+}
+
+func TestNestedEnvironment(t *testing.T) {
+	setUpTest()
+	a := setUpApp(t, "aws", nestedDefinition, acmeKeys)
+	ioutil.WriteFile(path.Join(a.Path, "prod"), []byte(nestedEnv), 0644)
+	env, err := a.NewEnv("prod")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	env.PopulateExportVars()
+	expected := map[string]string{"AWS_REGION": "eu-west-1", "AWS_ZONES": "eu-west-1a eu-west-1b",
+		"HOSTS": "alpha:beta", "VERSION": "1.10"}
+	for k, v := range expected {
+		if env.ExportVariables[k] != v {
+			t.Errorf("Expected %s to be %s, found %s", k, v, env.ExportVariables[k])
+		}
+	}
+	if err := a.Set("prod", map[string]string{"aws.prod.region": "eu-west-2"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	d, _ := ioutil.ReadFile(path.Join(a.Path, "prod"))
+	if !strings.HasPrefix(string(d), "aws:\n  prod:\n    region: eu-west-2\n") {
+		t.Errorf("Expected the environment to stay nested, found\n%s", d)
+	}
+	if err := a.Copy("prod", "qa", map[string]string{"hosts": "gamma"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	expectedLists := map[string]map[string]string{
+		"prod": {"aws.prod.zones": "eu-west-1a eu-west-1b", "hosts": "alpha beta"},
+		"qa":   {"aws.prod.zones": "eu-west-1a eu-west-1b"},
+	}
+	for envName, expected := range expectedLists {
+		d, _ := ioutil.ReadFile(path.Join(a.Path, envName))
+		layout := newEnvLayout()
+		if _, err := flattenYaml(d, func(string) string { return " " }, layout); err != nil {
+			t.Fatal(err.Error())
+		}
+		lists := layout.lists
+		if len(lists) != len(expected) {
+			t.Errorf("Expected lists %v in %s, found\n%s", expected, envName, d)
+		}
+		for k, v := range expected {
+			if strings.Join(lists[k], " ") != v {
+				t.Errorf("Expected %s to stay a list of %s in %s, found\n%s", k, v, envName, d)
+			}
+		}
+	}
+}
+
+func TestNestVariables(t *testing.T) {
+	values := map[string]string{"a": "x", "a.b": "y", "c.d": "z", "c.e": "w"}
+	d, _ := yaml.Marshal(nestVariables([]string{"c.e", "a.b", "a", "c.d"}, values, nil))
+	if string(d) != "a: x\na.b: \"y\"\nc:\n  d: z\n  e: w\n" {
+		t.Errorf("Expected keys clashing with a value to stay dotted, found\n%s", d)
+	}
+}
@@ -0,0 +1,157 @@
+package sellsword
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// Selection pairs an application with one of its environments, as given on the
+// command line in the form app=env
+type Selection struct {
+	App *App
+	Env *Env
+}
+
+// keptVars survive when a command is run in a clean environment
+var keptVars = []string{"HOME", "LANG", "LOGNAME", "PATH", "SHELL", "TERM", "TMPDIR", "USER"}
+
+// hookVars are set by the shell hook for a single invocation of ssw and must not
+// reach the commands it runs, or an ssw run inside them would write to the eval file
+var hookVars = []string{"SSW_EVAL_FILE", "SSW_HOOK"}
+
+// Select resolves app=env pairs to Selections without changing the current
+// environment of any application
+func (as *AppSet) Select(pairs []string) ([]*Selection, error) {
+	sels := make([]*Selection, 0)
+	for i := range pairs {
+		appEnv := strings.SplitN(pairs[i], "=", 2)
+		if len(appEnv) != 2 || appEnv[0] == "" || appEnv[1] == "" {
+			return sels, errors.New(fmt.Sprintf("%s is not of the form app=env", pairs[i]))
+		}
+		a, err := NewApp(appEnv[0], as.Home)
+		if err != nil {
+			return sels, err
+		}
+		env, err := a.NewEnv(appEnv[1])
+		if err != nil {
+			return sels, err
+		}
+		if _, err := os.Stat(env.Path); err != nil {
+			return sels, errors.New(fmt.Sprintf("Environment %s does not exist for application %s",
+				appEnv[1], a.Name))
+		}
+		sels = append(sels, &Selection{App: a, Env: env})
+	}
+	return sels, nil
+}
+
+// Environ builds the process environment for sels, starting from the current
+// process environment or, if clean is set, from only a handful of basic variables
+func Environ(sels []*Selection, clean bool) ([]string, error) {
+	vars := make(map[string]string)
+	for _, kv := range os.Environ() {
+		keyValue := strings.SplitN(kv, "=", 2)
+		if len(keyValue) == 2 && (!clean || contains(keptVars, keyValue[0])) {
+			vars[keyValue[0]] = keyValue[1]
+		}
+	}
+	for _, key := range hookVars {
+		delete(vars, key)
+	}
+	for i := range sels {
+		if sels[i].App.EnvType != "environment" {
+			continue
+		}
+		// don't let variables of whatever environment the parent shell loaded leak through
+		for _, key := range sels[i].App.EnumerateExportVars() {
+			delete(vars, key)
+		}
+		if err := sels[i].Env.PopulateExportVars(); err != nil {
+			return []string{}, err
+		}
+		for k, v := range sels[i].Env.ExportVariables {
+			vars[k] = v
+		}
+	}
+	environ := make([]string, 0, len(vars))
+	for k, v := range vars {
+		environ = append(environ, k+"="+v)
+	}
+	return environ, nil
+}
+
+// Run runs name with args in the environments of sels, running their load actions
+// before and unload actions after. The command is run as a child process rather
+// than exec'd so that the unload actions get to run. Returns the exit status of
+// the command
+func Run(sels []*Selection, clean bool, name string, args ...string) (int, error) {
+	return run(sels, clean, []string{}, name, args...)
+}
+
+// RunShell starts $SHELL in the environments of sels, with SSW_SHELL_ENVS set to
+// the selected app=env pairs so that prompts can show them
+func RunShell(sels []*Selection, clean bool) (int, error) {
+	pairs := make([]string, len(sels))
+	for i := range sels {
+		pairs[i] = sels[i].App.Name + "=" + sels[i].Env.Name
+	}
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	return run(sels, clean, []string{"SSW_SHELL_ENVS=" + strings.Join(pairs, " ")}, shell)
+}
+
+func run(sels []*Selection, clean bool, extraEnv []string, name string, args ...string) (int, error) {
+	environ, err := Environ(sels, clean)
+	if err != nil {
+		return 1, err
+	}
+	for i := range sels {
+		if sels[i].App.EnvType != "environment" {
+			Logger.Warnf("Targets of application %s are not switched to %s, only its load action is run",
+				sels[i].App.Name, sels[i].Env.Name)
+		}
+		if err := sels[i].App.runEnvAction("load", sels[i].Env); err != nil {
+			unloadSelections(sels[:i])
+			return 1, err
+		}
+	}
+	defer unloadSelections(sels)
+
+	cmd := exec.Command(name, args...)
+	cmd.Env = append(environ, extraEnv...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// the terminal delivers interrupts to the child as well, we only need to
+	// survive them long enough to run the unload actions
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGQUIT)
+	defer signal.Stop(signals)
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+				if status.Signaled() {
+					return 128 + int(status.Signal()), nil
+				}
+				return status.ExitStatus(), nil
+			}
+		}
+		return 1, err
+	}
+	return 0, nil
+}
+
+func unloadSelections(sels []*Selection) {
+	for i := len(sels) - 1; i >= 0; i-- {
+		if err := sels[i].App.runEnvAction("unload", sels[i].Env); err != nil {
+			Logger.Errorln(err.Error())
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package sellsword
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestSelect(t *testing.T) {
+	setUpTest()
+	wd, _ := os.Getwd()
+	as, _ := NewAppSet(path.Join(wd, "test"))
+	sels, err := as.Select([]string{"aws=acme", "chef=acme"})
+	if err != nil {
+		t.Fatalf("Expected selections to resolve, received error %s", err.Error())
+	}
+	if len(sels) != 2 || sels[0].App.Name != "aws" || sels[1].Env.Name != "acme" {
+		t.Errorf("Selections did not match aws=acme chef=acme")
+	}
+}
+
+func TestSelectInvalid(t *testing.T) {
+	setUpTest()
+	wd, _ := os.Getwd()
+	as, _ := NewAppSet(path.Join(wd, "test"))
+	for _, pair := range []string{"aws", "aws=", "=acme", "aws=doesnotexist", "doesnotexist=acme"} {
+		if _, err := as.Select([]string{pair}); err == nil {
+			t.Errorf("Expected error selecting %s but did not receive one", pair)
+		}
+	}
+}
+
+func TestEnvironClean(t *testing.T) {
+	setUpTest()
+	wd, _ := os.Getwd()
+	as, _ := NewAppSet(path.Join(wd, "test"))
+	sels, _ := as.Select([]string{"aws=acme"})
+	os.Setenv("SSW_TEST_LEAK", "leak")
+	os.Setenv("AWS_SECRET_KEY", "stale")
+	defer os.Unsetenv("SSW_TEST_LEAK")
+	defer os.Unsetenv("AWS_SECRET_KEY")
+	environ, _ := Environ(sels, true)
+	joined := "\n" + strings.Join(environ, "\n") + "\n"
+	if !strings.Contains(joined, "\nAWS_REGION=nowhere\n") {
+		t.Errorf("Expected environment to contain AWS_REGION=nowhere, found %v", environ)
+	}
+	if strings.Contains(joined, "SSW_TEST_LEAK") {
+		t.Errorf("Expected clean environment to drop SSW_TEST_LEAK, found %v", environ)
+	}
+	if strings.Contains(joined, "AWS_SECRET_KEY") {
+		t.Errorf("Expected AWS_SECRET_KEY of the parent environment to be dropped, found %v", environ)
+	}
+	os.Setenv("SSW_EVAL_FILE", "/tmp/ssw-eval")
+	os.Setenv("SSW_HOOK", "bash")
+	defer os.Unsetenv("SSW_EVAL_FILE")
+	defer os.Unsetenv("SSW_HOOK")
+	environ, _ = Environ(sels, false)
+	joined = strings.Join(environ, "\n")
+	if !strings.Contains(joined, "SSW_TEST_LEAK=leak") {
+		t.Errorf("Expected environment to keep SSW_TEST_LEAK, found %v", environ)
+	}
+	if strings.Contains(joined, "SSW_EVAL_FILE") || strings.Contains(joined, "SSW_HOOK") {
+		t.Errorf("Expected the variables of the shell hook to be dropped, found %v", environ)
+	}
+}
+
+func TestRun(t *testing.T) {
+	tmp := setUpTest()
+	wd, _ := os.Getwd()
+	as, _ := NewAppSet(path.Join(wd, "test"))
+	sels, _ := as.Select([]string{"aws=acme"})
+	currentBefore, _ := os.Readlink(path.Join(wd, "test/aws/current"))
+	output := path.Join(tmp, "run-test")
+	os.Remove(output)
+	defer os.Remove(output)
+	status, err := Run(sels, false, "/bin/sh", "-c", "echo $AWS_REGION > "+output+"; exit 3")
+	if err != nil {
+		t.Fatalf("Expected command to run, received error %s", err.Error())
+	}
+	if status != 3 {
+		t.Errorf("Expected exit status 3, found %d", status)
+	}
+	d, _ := ioutil.ReadFile(output)
+	if actual := strings.TrimSpace(string(d)); actual != "nowhere" {
+		t.Errorf("Expected command to see AWS_REGION=nowhere, found %s", actual)
+	}
+	currentAfter, _ := os.Readlink(path.Join(wd, "test/aws/current"))
+	if currentBefore != currentAfter {
+		t.Errorf("Expected current symlink to be untouched, it changed from %s to %s", currentBefore, currentAfter)
+	}
+}
+
+func TestRunShell(t *testing.T) {
+	tmp := setUpTest()
+	wd, _ := os.Getwd()
+	as, _ := NewAppSet(path.Join(wd, "test"))
+	sels, _ := as.Select([]string{"aws=acme", "chef=acme"})
+	output := path.Join(tmp, "shell-test")
+	fakeShell := path.Join(tmp, "fake-shell")
+	os.Remove(output)
+	defer os.Remove(output)
+	ioutil.WriteFile(fakeShell, []byte("#!/bin/sh\necho \"$SSW_SHELL_ENVS $AWS_REGION\" > "+output+"\n"), 0755)
+	defer os.Remove(fakeShell)
+	original := os.Getenv("SHELL")
+	os.Setenv("SHELL", fakeShell)
+	status, err := RunShell(sels, false)
+	os.Setenv("SHELL", original)
+	if err != nil || status != 0 {
+		t.Fatalf("Expected shell to exit cleanly, found status %d and error %v", status, err)
+	}
+	d, _ := ioutil.ReadFile(output)
+	expected := "aws=acme chef=acme nowhere"
+	if actual := strings.TrimSpace(string(d)); actual != expected {
+		t.Errorf("Expected shell to see %s, found %s", expected, actual)
+	}
+}
@@ -0,0 +1,100 @@
+package sellsword
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/fatih/color"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+)
+
+// MaskedValue is shown in place of the value of a secret variable
+const MaskedValue = "********"
+
+// IsSecret reports whether the variable key holds a secret, such as a password
+func (e *Env) IsSecret(key string) bool {
+	return contains(e.Secrets, key)
+}
+
+// DisplayValue returns the value of the variable key, masked if it is a secret
+func (e *Env) DisplayValue(key string) string {
+	if e.IsSecret(key) {
+		return MaskedValue
+	}
+	return e.Variables[key]
+}
+
+// maskedExportVars returns the export variables with the values of secrets masked,
+// for logging
+func (e *Env) maskedExportVars(keys map[string]string) map[string]string {
+	masked := make(map[string]string, len(e.ExportVariables))
+	for envName, value := range e.ExportVariables {
+		if e.IsSecret(keys[envName]) {
+			masked[envName] = MaskedValue
+		} else {
+			masked[envName] = value
+		}
+	}
+	return masked
+}
+
+// stty changes the settings of the terminal on stdin
+func stty(args ...string) error {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
+
+// readHidden reads a line from reader with terminal echo turned off. Echo is
+// turned back on even if the user interrupts
+func readHidden(reader *bufio.Reader) (string, error) {
+	if err := stty("-echo"); err != nil {
+		return "", errors.New(fmt.Sprintf("Could not turn off terminal echo: %s", err.Error()))
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	done := make(chan bool)
+	go func() {
+		select {
+		case <-signals:
+			stty("echo")
+			fmt.Fprintln(Out)
+			os.Exit(130)
+		case <-done:
+		}
+	}()
+	defer func() {
+		close(done)
+		signal.Stop(signals)
+		stty("echo")
+		// the newline typed by the user was not echoed
+		fmt.Fprintln(Out)
+	}()
+	text, err := reader.ReadString('\n')
+	return strings.TrimSpace(text), err
+}
+
+// promptSecret asks for a secret value with prompt without echoing it, asking a
+// second time until both answers match if confirm is set
+func promptSecret(reader *bufio.Reader, prompt string, confirm bool) (string, error) {
+	for {
+		fmt.Fprintf(Out, "%s (hidden): ", prompt)
+		value, err := readHidden(reader)
+		if err != nil || !confirm {
+			return value, err
+		}
+		fmt.Fprintf(Out, "%s (again): ", prompt)
+		again, err := readHidden(reader)
+		if err != nil {
+			return value, err
+		}
+		if value == again {
+			return value, nil
+		}
+		red := GetTermPrinterF(color.FgRed)
+		fmt.Fprint(Out, red("The values do not match, try again\n"))
+	}
+}
@@ -0,0 +1,53 @@
+package sellsword
+
+import (
+	"bytes"
+	"github.com/Sirupsen/logrus"
+	"os"
+	"strings"
+	"testing"
+)
+
+// acmeKeys are the environments of the applications made by secret tests
+var acmeKeys = map[string]string{"acme": "access_key: AKIA\nsecret_key: hunter2\n"}
+
+func TestSecretsAreMasked(t *testing.T) {
+	setUpTest()
+	a := setUpApp(t, "aws", "type: environment\nvariables:\n  - access_key=AWS_ACCESS_KEY_ID\n"+
+		"  - secret_key=AWS_SECRET_ACCESS_KEY\nsecrets:\n  - secret_key\n", acmeKeys)
+	env, _ := a.NewEnv("acme")
+	if env.DisplayValue("secret_key") != MaskedValue || env.DisplayValue("access_key") != "AKIA" {
+		t.Errorf("Expected only secret_key to be masked, found %s and %s", env.DisplayValue("secret_key"),
+			env.DisplayValue("access_key"))
+	}
+	var logged bytes.Buffer
+	Logger.Out = &logged
+	Logger.Level = logrus.DebugLevel
+	defer setUpTest()
+	env.PopulateExportVars()
+	if strings.Contains(logged.String(), "hunter2") || !strings.Contains(logged.String(), "AKIA") {
+		t.Errorf("Expected the secret to be masked in debug output, found %s", logged.String())
+	}
+}
+
+func TestSecretsAreSavedPrivately(t *testing.T) {
+	setUpTest()
+	a := setUpApp(t, "aws", "type: environment\nvariables:\n  - secret_key=AWS_SECRET_ACCESS_KEY\n"+
+		"secrets:\n  - secret_key\n", acmeKeys)
+	env, _ := a.NewEnv("new")
+	if err := env.Construct(map[string]string{"secret_key": "hunter2"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if fi, _ := os.Stat(env.Path); fi == nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("Expected environment with secrets to be readable only by its owner, found %v", fi)
+	}
+}
+
+func TestUnknownSecretIsRejected(t *testing.T) {
+	setUpTest()
+	home := setUpHome(t, "aws", "type: environment\nvariables:\n  - access_key=AWS_ACCESS_KEY_ID\n"+
+		"secrets:\n  - password\n", nil)
+	if _, err := NewApp("aws", home); err == nil {
+		t.Error("Expected error for a secret that is not a variable but did not receive one")
+	}
+}
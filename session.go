@@ -0,0 +1,141 @@
+package sellsword
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Session records the environments selected in a single terminal. Each
+// selection is a symlink named after the application inside
+// ~/.ssw/.sessions/<id>/, shadowing the application's global current symlink
+type Session struct {
+	ID   string
+	Path string
+}
+
+var sessionID = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+func sessionsDir(sswHome string) string {
+	return path.Join(sswHome, ".sessions")
+}
+
+// NewSession returns the session with the given id, creating it if necessary.
+// A new session remembers the pid of the shell that owns it, which is the id
+// itself for the numeric ids set by `sellsword init --session`, along with the
+// time the shell started so that a process that reuses the pid is not taken for it
+func NewSession(sswHome string, id string) (*Session, error) {
+	s := new(Session)
+	s.ID = id
+	if !sessionID.MatchString(id) || id == "." || id == ".." {
+		return s, errors.New(fmt.Sprintf("%s is not a valid session id", id))
+	}
+	s.Path = path.Join(sessionsDir(sswHome), id)
+	if _, err := os.Stat(s.Path); os.IsNotExist(err) {
+		if err := os.MkdirAll(s.Path, 0700); err != nil {
+			return s, err
+		}
+		pid := id
+		if _, err := strconv.Atoi(id); err != nil {
+			pid = strconv.Itoa(os.Getppid())
+		}
+		record := pid
+		if started, err := processStartTime(pid); err == nil {
+			record += " " + started
+		}
+		Logger.Debugf("Created session %s for pid %s", id, record)
+		return s, ioutil.WriteFile(path.Join(s.Path, "pid"), []byte(record+"\n"), 0600)
+	}
+	return s, nil
+}
+
+// Link records envPath as the environment of appName for this session
+func (s *Session) Link(appName string, envPath string) error {
+	link := path.Join(s.Path, appName)
+	os.Remove(link)
+	return os.Symlink(envPath, link)
+}
+
+// Unlink forgets the environment of appName for this session so that the
+// global current environment applies again
+func (s *Session) Unlink(appName string) error {
+	link := path.Join(s.Path, appName)
+	if _, err := os.Lstat(link); os.IsNotExist(err) {
+		Logger.Debugf("Session %s has no environment for %s, nothing to do", s.ID, appName)
+		return nil
+	}
+	return os.Remove(link)
+}
+
+// Alive reports whether the shell owning the session is still running. If the
+// pid file records when the shell started, a process running under the same pid
+// must have started at the same time
+func (s *Session) Alive() bool {
+	d, err := ioutil.ReadFile(path.Join(s.Path, "pid"))
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(d))
+	if len(fields) == 0 {
+		return false
+	}
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil || pid <= 0 {
+		return false
+	}
+	if err := syscall.Kill(pid, 0); err != nil && err != syscall.EPERM {
+		return false
+	}
+	if len(fields) > 1 {
+		if started, err := processStartTime(fields[0]); err == nil {
+			return started == fields[1]
+		}
+	}
+	return true
+}
+
+// processStartTime returns when the process pid started, in clock ticks since
+// boot as /proc/<pid>/stat gives it. Systems without /proc return an error
+func processStartTime(pid string) (string, error) {
+	d, err := ioutil.ReadFile(path.Join("/proc", pid, "stat"))
+	if err != nil {
+		return "", err
+	}
+	// the command name in parentheses may itself hold spaces and parentheses
+	stat := string(d)
+	fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+	// the start time is the 22nd field, counting the pid and command name
+	if len(fields) < 20 {
+		return "", errors.New(fmt.Sprintf("Cannot read the start time of process %s from %s", pid, stat))
+	}
+	return fields[19], nil
+}
+
+// CollectSessions removes the sessions whose shells are no longer running and
+// returns their ids
+func CollectSessions(sswHome string) ([]string, error) {
+	removed := make([]string, 0)
+	di, err := ioutil.ReadDir(sessionsDir(sswHome))
+	if os.IsNotExist(err) {
+		return removed, nil
+	} else if err != nil {
+		return removed, err
+	}
+	for i := range di {
+		s := &Session{ID: di[i].Name(), Path: path.Join(sessionsDir(sswHome), di[i].Name())}
+		if !s.Alive() {
+			Logger.Debugf("Removing dead session %s", s.ID)
+			if err := os.RemoveAll(s.Path); err != nil {
+				return removed, err
+			}
+			removed = append(removed, s.ID)
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,112 @@
+package sellsword
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"testing"
+)
+
+func TestNewSession(t *testing.T) {
+	tmp := setUpTest()
+	home := path.Join(tmp, "session-home")
+	defer os.RemoveAll(home)
+	s, err := NewSession(home, strconv.Itoa(os.Getpid()))
+	if err != nil {
+		t.Fatalf("Expected session to be created, received error %s", err.Error())
+	}
+	if !s.Alive() {
+		t.Errorf("Expected session %s for running process to be alive", s.ID)
+	}
+	for _, id := range []string{"", "..", "../escape", "a/b"} {
+		if _, err := NewSession(home, id); err == nil {
+			t.Errorf("Expected error for session id %s but did not receive one", id)
+		}
+	}
+}
+
+func TestAppCurrentHonorsSession(t *testing.T) {
+	setUpTest()
+	wd, _ := os.Getwd()
+	home := path.Join(wd, "test")
+	relink(path.Join(home, "aws/dyncorp"), path.Join(home, "aws/current"))
+	id := strconv.Itoa(os.Getpid())
+	defer os.RemoveAll(sessionsDir(home))
+	defer os.RemoveAll(path.Join(home, ".locks"))
+	a, _ := NewApp("aws", home)
+	a.Session = id
+	if err := a.MakeSessionCurrent("acme"); err != nil {
+		t.Fatalf("Expected session switch to succeed, received error %s", err.Error())
+	}
+	if e, _ := a.Current(); e == nil || e.Name != "acme" {
+		t.Errorf("Expected current env for session to be acme, found %v", e)
+	}
+	global, _ := os.Readlink(path.Join(home, "aws/current"))
+	if global != path.Join(home, "aws/dyncorp") {
+		t.Errorf("Expected global current to remain dyncorp, found %s", global)
+	}
+	other, _ := NewApp("aws", home)
+	other.Session = ""
+	if e, _ := other.Current(); e == nil || e.Name != "dyncorp" {
+		t.Errorf("Expected current env outside the session to be dyncorp, found %v", e)
+	}
+	a.UnlinkSession()
+	if e, _ := a.Current(); e == nil || e.Name != "dyncorp" {
+		t.Errorf("Expected session to fall back to global env dyncorp after unlink, found %v", e)
+	}
+}
+
+func TestMakeSessionCurrentRejectsDirectoryApps(t *testing.T) {
+	setUpTest()
+	setUpFixtures(t)
+	wd, _ := os.Getwd()
+	a, _ := NewApp("chef", path.Join(wd, "test"))
+	a.Session = "test"
+	if err := a.MakeSessionCurrent("acme"); err == nil {
+		t.Error("Expected error scoping a directory application to a session but did not receive one")
+	}
+}
+
+func TestCollectSessions(t *testing.T) {
+	tmp := setUpTest()
+	home := path.Join(tmp, "session-home")
+	defer os.RemoveAll(home)
+	alive, _ := NewSession(home, strconv.Itoa(os.Getpid()))
+	cmd := exec.Command("true")
+	cmd.Run()
+	dead, _ := NewSession(home, strconv.Itoa(cmd.Process.Pid))
+	removed, err := CollectSessions(home)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(removed) != 1 || removed[0] != dead.ID {
+		t.Errorf("Expected only session %s to be collected, found %v", dead.ID, removed)
+	}
+	if _, err := ioutil.ReadDir(alive.Path); err != nil {
+		t.Errorf("Expected live session %s to be kept", alive.ID)
+	}
+}
+
+func TestSessionOfReusedPidIsDead(t *testing.T) {
+	tmp := setUpTest()
+	home := path.Join(tmp, "session-home")
+	defer os.RemoveAll(home)
+	s, _ := NewSession(home, strconv.Itoa(os.Getpid()))
+	if _, err := processStartTime(s.ID); err != nil {
+		t.Skip("process start times are not available: " + err.Error())
+	}
+	if !s.Alive() {
+		t.Errorf("Expected session %s for running process to be alive", s.ID)
+	}
+	// as if the shell had exited and another process had been given its pid
+	ioutil.WriteFile(path.Join(s.Path, "pid"), []byte(s.ID+" 1\n"), 0600)
+	if s.Alive() {
+		t.Errorf("Expected session %s to be dead once another process has its pid", s.ID)
+	}
+	ioutil.WriteFile(path.Join(s.Path, "pid"), []byte(s.ID+"\n"), 0600)
+	if !s.Alive() {
+		t.Errorf("Expected session %s without a start time to be alive while its pid runs", s.ID)
+	}
+}
@@ -0,0 +1,148 @@
+package sellsword
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Shell renders statements in the dialect of a particular shell so that they
+// can be evaluated by the parent shell
+type Shell interface {
+	Name() string
+	Export(key string, value string) string
+	Unset(key string) string
+	// Hook returns the ssw function that users evaluate in their rc file,
+	// optionally turning on per-terminal session mode
+	Hook(session bool) string
+}
+
+type bashShell struct{}
+
+func (s bashShell) Name() string { return "bash" }
+
+func (s bashShell) Export(key string, value string) string {
+	return fmt.Sprintf("export %s=%s", key, posixQuote(value))
+}
+
+func (s bashShell) Unset(key string) string {
+	return fmt.Sprintf("unset %s", key)
+}
+
+// zsh treats a bare typeset inside a function as local, so we always ask for
+// a global export explicitly
+type zshShell struct{}
+
+func (s zshShell) Name() string { return "zsh" }
+
+func (s zshShell) Export(key string, value string) string {
+	return fmt.Sprintf("typeset -gx %s=%s", key, posixQuote(value))
+}
+
+func (s zshShell) Unset(key string) string {
+	return fmt.Sprintf("unset %s", key)
+}
+
+type fishShell struct{}
+
+func (s fishShell) Name() string { return "fish" }
+
+func (s fishShell) Export(key string, value string) string {
+	return fmt.Sprintf("set -gx %s %s", key, fishQuote(value))
+}
+
+func (s fishShell) Unset(key string) string {
+	return fmt.Sprintf("set -e %s", key)
+}
+
+// posixShell sticks to what the oldest Bourne shells understand
+type posixShell struct{}
+
+func (s posixShell) Name() string { return "sh" }
+
+func (s posixShell) Export(key string, value string) string {
+	return fmt.Sprintf("%s=%s; export %s", key, posixQuote(value), key)
+}
+
+func (s posixShell) Unset(key string) string {
+	return fmt.Sprintf("unset %s", key)
+}
+
+// Values made only of these characters are never interpreted by a shell
+var safeValue = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// isValidIdentifier reports whether name can be used as an environment variable
+// name in every supported shell
+func isValidIdentifier(name string) bool {
+	return identifier.MatchString(name)
+}
+
+// posixQuote wraps value in single quotes, inside which sh, bash and zsh do not
+// expand anything. A single quote itself has to be closed, escaped and reopened
+func posixQuote(value string) string {
+	if safeValue.MatchString(value) {
+		return value
+	}
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+// fishQuote wraps value in single quotes. Unlike POSIX shells, fish allows
+// backslash escapes for backslashes and single quotes inside single quotes
+func fishQuote(value string) string {
+	if safeValue.MatchString(value) {
+		return value
+	}
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, "'", `\'`, -1)
+	return "'" + value + "'"
+}
+
+var shells = map[string]Shell{
+	"bash": bashShell{},
+	"zsh":  zshShell{},
+	"fish": fishShell{},
+	"sh":   posixShell{},
+	"dash": posixShell{},
+	"ksh":  posixShell{},
+}
+
+// OutputShell is the dialect used for statements printed for the parent shell
+var OutputShell Shell = bashShell{}
+
+// NewShell returns the Shell for the dialect name, e.g. bash, zsh, fish or sh
+func NewShell(name string) (Shell, error) {
+	if s, ok := shells[path.Base(name)]; ok {
+		return s, nil
+	} else {
+		return nil, errors.New(fmt.Sprintf("Unsupported shell %s, supported shells are %v", name, ShellNames()))
+	}
+}
+
+// DetectShell guesses the dialect from $SSW_HOOK, which the ssw function sets, or
+// from $SHELL, falling back to bash
+func DetectShell() Shell {
+	if s, err := NewShell(os.Getenv("SSW_HOOK")); err == nil {
+		return s
+	} else if s, err := NewShell(os.Getenv("SHELL")); err == nil {
+		return s
+	} else {
+		Logger.Debugf("Could not detect shell from $SHELL, defaulting to bash")
+		return bashShell{}
+	}
+}
+
+// ShellNames lists the names accepted by NewShell
+func ShellNames() []string {
+	names := make([]string, 0, len(shells))
+	for name := range shells {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
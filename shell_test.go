@@ -0,0 +1,89 @@
+package sellsword
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestNewShell(t *testing.T) {
+	setUpTest()
+	expected := map[string]string{"bash": "bash", "/bin/zsh": "zsh", "/usr/local/bin/fish": "fish",
+		"sh": "sh", "/bin/dash": "sh"}
+	for name, dialect := range expected {
+		if sh, err := NewShell(name); err != nil {
+			t.Errorf("Expected shell %s to be supported, received error %s", name, err.Error())
+		} else if sh.Name() != dialect {
+			t.Errorf("Expected shell %s to use dialect %s, found %s", name, dialect, sh.Name())
+		}
+	}
+}
+
+func TestNewShellUnsupported(t *testing.T) {
+	setUpTest()
+	if _, err := NewShell("powershell"); err == nil {
+		t.Error("Expected error for unsupported shell but did not receive one")
+	}
+}
+
+func TestDetectShell(t *testing.T) {
+	setUpTest()
+	original := os.Getenv("SHELL")
+	defer os.Setenv("SHELL", original)
+	os.Setenv("SHELL", "/usr/bin/fish")
+	if sh := DetectShell(); sh.Name() != "fish" {
+		t.Errorf("Expected shell to be detected as fish, found %s", sh.Name())
+	}
+	os.Setenv("SHELL", "/bin/tcsh")
+	if sh := DetectShell(); sh.Name() != "bash" {
+		t.Errorf("Expected unknown shell to fall back to bash, found %s", sh.Name())
+	}
+}
+
+func TestShellQuoting(t *testing.T) {
+	setUpTest()
+	value := `it's $HOME and "quoted" \ ` + "`date`"
+	expected := map[Shell]string{
+		bashShell{}:  `export SECRET='it'\''s $HOME and "quoted" \ ` + "`date`'",
+		zshShell{}:   `typeset -gx SECRET='it'\''s $HOME and "quoted" \ ` + "`date`'",
+		fishShell{}:  `set -gx SECRET 'it\'s $HOME and "quoted" \\ ` + "`date`'",
+		posixShell{}: `SECRET='it'\''s $HOME and "quoted" \ ` + "`date`'; export SECRET",
+	}
+	for sh, statement := range expected {
+		if actual := sh.Export("SECRET", value); actual != statement {
+			t.Errorf("Expected %s export to be %s, found %s", sh.Name(), statement, actual)
+		}
+	}
+	if actual := (bashShell{}).Export("EMPTY", ""); actual != "export EMPTY=''" {
+		t.Errorf("Expected empty value to be quoted, found %s", actual)
+	}
+}
+
+// the quoted value must survive a round trip through a real shell unchanged
+func TestShellQuotingRoundTrip(t *testing.T) {
+	setUpTest()
+	value := "pa ss'w$(echo pwned)rd\n `id` \"$HOME\""
+	for _, sh := range []Shell{bashShell{}, posixShell{}} {
+		script := sh.Export("SECRET", value) + "\nprintf %s \"$SECRET\""
+		out, err := exec.Command("/bin/sh", "-c", script).Output()
+		if err != nil {
+			t.Fatalf("Evaluating %s statements failed: %s", sh.Name(), err.Error())
+		}
+		if string(out) != value {
+			t.Errorf("Expected %s round trip to preserve %s, found %s", sh.Name(), value, string(out))
+		}
+	}
+}
+
+func TestIsValidIdentifier(t *testing.T) {
+	for _, name := range []string{"AWS_REGION", "_private", "a1"} {
+		if !isValidIdentifier(name) {
+			t.Errorf("Expected %s to be a valid identifier", name)
+		}
+	}
+	for _, name := range []string{"1AWS", "AWS-REGION", "AWS REGION", "", "$(id)"} {
+		if isValidIdentifier(name) {
+			t.Errorf("Expected %s to be rejected as an identifier", name)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package sellsword
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// parseToml reads a TOML environment file. TOML values are typed, so numbers are
+// read back as TOML understands them: 1.10 is the float 1.1. Quote values to keep
+// them as they are written
+func parseToml(data string) (envNode, error) {
+	var root map[string]interface{}
+	if _, err := toml.Decode(data, &root); err != nil {
+		return envNode{}, err
+	}
+	return tomlNode(root), nil
+}
+
+func tomlNode(value interface{}) envNode {
+	var n envNode
+	switch v := value.(type) {
+	case map[string]interface{}:
+		n.fields = make(map[string]envNode, len(v))
+		for k := range v {
+			n.fields[k] = tomlNode(v[k])
+		}
+	case []map[string]interface{}:
+		n.list = make([]envNode, len(v))
+		for i := range v {
+			n.list[i] = tomlNode(v[i])
+		}
+	case []interface{}:
+		n.list = make([]envNode, len(v))
+		for i := range v {
+			n.list[i] = tomlNode(v[i])
+		}
+	case time.Time:
+		layout, ok := tomlTimeLayouts[v.Location().String()]
+		if !ok {
+			layout = time.RFC3339Nano
+		}
+		scalar := v.Format(layout)
+		n.scalar, n.bare = &scalar, true
+	case string:
+		n.scalar = &v
+	default:
+		scalar := fmt.Sprintf("%v", v)
+		n.scalar, n.bare = &scalar, true
+	}
+	return n
+}
+
+// tomlTimeLayouts writes back the dates and times without an offset, which the
+// TOML decoder reads into these locations
+var tomlTimeLayouts = map[string]string{"datetime-local": "2006-01-02T15:04:05.999999999",
+	"date-local": "2006-01-02", "time-local": "15:04:05.999999999"}
+
+var tomlBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// writeToml writes the values of m as TOML, values first and then a table for
+// each map with values of its own
+func writeToml(out *bytes.Buffer, table []string, m yaml.MapSlice) {
+	header := false
+	for _, item := range m {
+		if _, ok := item.Value.(yaml.MapSlice); ok {
+			continue
+		}
+		if len(table) > 0 && !header {
+			if out.Len() > 0 {
+				out.WriteString("\n")
+			}
+			out.WriteString("[" + strings.Join(table, ".") + "]\n")
+			header = true
+		}
+		out.WriteString(tomlKey(fmt.Sprintf("%v", item.Key)) + " = " + tomlValue(item.Value) + "\n")
+	}
+	for _, item := range m {
+		if sub, ok := item.Value.(yaml.MapSlice); ok {
+			writeToml(out, append(append([]string{}, table...), tomlKey(fmt.Sprintf("%v", item.Key))), sub)
+		}
+	}
+}
+
+// tomlValue writes value as a TOML string, an array of strings for a list or as
+// it is for a bare value
+func tomlValue(value interface{}) string {
+	if items, ok := value.([]string); ok {
+		quoted := make([]string, len(items))
+		for i := range items {
+			quoted[i] = tomlString(items[i])
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	} else if bare, ok := value.(bareValue); ok {
+		return string(bare)
+	}
+	return tomlString(fmt.Sprintf("%v", value))
+}
+
+func tomlKey(key string) string {
+	if tomlBareKey.MatchString(key) {
+		return key
+	}
+	return tomlString(key)
+}
+
+// tomlString quotes s as a TOML basic string
+func tomlString(s string) string {
+	var out bytes.Buffer
+	out.WriteByte('"')
+	for _, r := range s {
+		if r == '"' || r == '\\' {
+			out.WriteByte('\\')
+			out.WriteRune(r)
+		} else if r == '\n' {
+			out.WriteString(`\n`)
+		} else if r == '\t' {
+			out.WriteString(`\t`)
+		} else if r == '\r' {
+			out.WriteString(`\r`)
+		} else if r < 0x20 || r == 0x7f {
+			out.WriteString(`\u` + fmt.Sprintf("%04X", r))
+		} else {
+			out.WriteRune(r)
+		}
+	}
+	out.WriteByte('"')
+	return out.String()
+}
@@ -0,0 +1,67 @@
+package sellsword
+
+import (
+	"strings"
+	"testing"
+)
+
+const tomlEnv = `# acme production
+extends = "acme-base"
+version = 1.10
+"quoted key" = 'C:\path'
+hosts = [
+  "alpha", # the first
+  "beta",
+]
+motd = """
+Welcome \
+to acme"""
+
+[aws.prod]
+region = "eu-west-1"  # Ireland
+zones = ["eu-west-1a", "eu-west-1b"]
+owner = { name = "ops", mail = "ops\u0040acme.com" }
+since = 1979-05-27 07:32:00Z
+until = 1999-12-31
+
+[aws]
+account = 1234
+`
+
+func TestParseToml(t *testing.T) {
+	root, err := parseToml(tomlEnv)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	values := make(map[string]string)
+	if err := root.flatten("", func(string) string { return "," }, values, nil); err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := map[string]string{"extends": "acme-base", "version": "1.1", "quoted key": `C:\path`,
+		"hosts": "alpha,beta", "motd": "Welcome to acme", "aws.prod.region": "eu-west-1",
+		"aws.prod.zones": "eu-west-1a,eu-west-1b", "aws.prod.owner.name": "ops",
+		"aws.prod.owner.mail": "ops@acme.com", "aws.prod.since": "1979-05-27T07:32:00Z",
+		"aws.prod.until": "1999-12-31", "aws.account": "1234"}
+	if len(values) != len(expected) {
+		t.Errorf("Expected %v, found %v", expected, values)
+	}
+	for k, v := range expected {
+		if values[k] != v {
+			t.Errorf("Expected %s to be %s, found %s", k, v, values[k])
+		}
+	}
+}
+
+func TestParseTomlErrors(t *testing.T) {
+	if _, err := parseToml("a = 1\na = 2\n"); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected error on line 2 for a key defined twice, found %v", err)
+	}
+	root, err := parseToml("[[servers]]\nhost = \"alpha\"\n")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	err = root.flatten("", func(string) string { return "," }, make(map[string]string), nil)
+	if err == nil || !strings.Contains(err.Error(), "servers is a list of lists or maps") {
+		t.Errorf("Expected an array of tables to be refused, found %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+package sellsword
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Removed environments are moved to ~/.ssw/.trash/<app>/<env>@<timestamp> so
+// that a mistaken rm can be undone
+const trashTimeFormat = "20060102-150405.000000000"
+
+// TrashItem is an environment sitting in the trash
+type TrashItem struct {
+	App     string
+	Env     string
+	Removed time.Time
+	Path    string
+}
+
+func trashDir(sswHome string) string {
+	return path.Join(sswHome, ".trash")
+}
+
+// Remove moves envName to the trash. The current environment is only removed if
+// force is set, in which case it is unloaded and unlinked first. The application
+// is locked for the duration
+func (a *App) Remove(envName string, force bool) (*TrashItem, error) {
+	unlock, err := a.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if envName == "" || envName == "current" || strings.HasPrefix(envName, ".") || strings.Contains(envName, "/") {
+		return nil, errors.New(fmt.Sprintf("%s is not a valid environment name", envName))
+	}
+	envPath := path.Join(a.Path, envName)
+	if _, err := os.Lstat(envPath); err != nil {
+		return nil, errors.New(fmt.Sprintf("Environment %s does not exist for application %s", envName, a.Name))
+	}
+	if children := a.extendedBy(envName); len(children) > 0 && !force {
+		return nil, errors.New(fmt.Sprintf("Environments %s of application %s extend %s, "+
+			"use --force to remove it anyway", envNamesOf(children), a.Name, envName))
+	}
+	globalLink := path.Join(a.Path, "current")
+	// the environment may be the global current one even if this session has another
+	isCurrent, isGlobal := linksTo(a.currentLink(), envName), linksTo(globalLink, envName)
+	if (isCurrent || isGlobal) && !force {
+		return nil, errors.New(fmt.Sprintf("%s is the current environment of application %s, "+
+			"use --force to remove it anyway", envName, a.Name))
+	}
+	if isCurrent {
+		if err := a.Unload(); err != nil {
+			Logger.Warnln(err.Error())
+		}
+		if a.currentLink() != globalLink {
+			if err := a.UnlinkSession(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if isGlobal {
+		if err := a.unlink(); err != nil {
+			return nil, err
+		}
+	}
+	removed := time.Now()
+	item := &TrashItem{App: a.Name, Env: envName, Removed: removed,
+		Path: path.Join(trashDir(a.Home), a.Name, envName+"@"+removed.Format(trashTimeFormat))}
+	if err := os.MkdirAll(path.Dir(item.Path), 0700); err != nil {
+		return nil, err
+	}
+	return item, os.Rename(envPath, item.Path)
+}
+
+func linksTo(link string, envName string) bool {
+	current, err := resolveSymlink(link)
+	return err == nil && path.Base(current) == envName
+}
+
+// ListTrash returns the environments in the trash for appNames, or for every
+// application if none are given, oldest first
+func ListTrash(sswHome string, appNames ...string) ([]*TrashItem, error) {
+	items := make([]*TrashItem, 0)
+	if len(appNames) == 0 {
+		di, err := ioutil.ReadDir(trashDir(sswHome))
+		if os.IsNotExist(err) {
+			return items, nil
+		} else if err != nil {
+			return items, err
+		}
+		for i := range di {
+			appNames = append(appNames, di[i].Name())
+		}
+	}
+	for _, appName := range appNames {
+		dir := path.Join(trashDir(sswHome), appName)
+		di, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return items, err
+		}
+		for i := range di {
+			name := di[i].Name()
+			at := strings.LastIndex(name, "@")
+			if at < 0 {
+				continue
+			}
+			removed, err := time.ParseInLocation(trashTimeFormat, name[at+1:], time.Local)
+			if err != nil {
+				continue
+			}
+			items = append(items, &TrashItem{App: appName, Env: name[:at], Removed: removed,
+				Path: path.Join(dir, name)})
+		}
+	}
+	sort.Sort(byRemoved(items))
+	return items, nil
+}
+
+type byRemoved []*TrashItem
+
+func (items byRemoved) Len() int           { return len(items) }
+func (items byRemoved) Swap(i, j int)      { items[i], items[j] = items[j], items[i] }
+func (items byRemoved) Less(i, j int) bool { return items[i].Removed.Before(items[j].Removed) }
+
+// RestoreTrash moves the most recently removed version of envName back into
+// place. It refuses to overwrite an environment of the same name
+func RestoreTrash(sswHome string, appName string, envName string) error {
+	items, err := ListTrash(sswHome, appName)
+	if err != nil {
+		return err
+	}
+	for i := len(items) - 1; i >= 0; i-- {
+		if items[i].Env == envName {
+			envPath := path.Join(sswHome, appName, envName)
+			if _, err := os.Lstat(envPath); err == nil {
+				return errors.New(fmt.Sprintf("Environment %s already exists for application %s, "+
+					"remove or rename it first", envName, appName))
+			}
+			return os.Rename(items[i].Path, envPath)
+		}
+	}
+	return errors.New(fmt.Sprintf("There is no environment %s for application %s in the trash", envName, appName))
+}
+
+// PurgeTrash deletes the environments in the trash for appNames, or for every
+// application if none are given, for good
+func PurgeTrash(sswHome string, appNames ...string) ([]*TrashItem, error) {
+	items, err := ListTrash(sswHome, appNames...)
+	if err != nil {
+		return items, err
+	}
+	for i := range items {
+		if err := os.RemoveAll(items[i].Path); err != nil {
+			return items[:i], err
+		}
+	}
+	return items, nil
+}
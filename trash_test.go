@@ -0,0 +1,78 @@
+package sellsword
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestRemoveAndRestoreTrash(t *testing.T) {
+	setUpTest()
+	a := setUpRollbackApp(t)
+	item, err := a.Remove("good", false)
+	if err != nil {
+		t.Fatalf("Expected remove to succeed, received error %s", err.Error())
+	}
+	if _, err := os.Stat(path.Join(a.Path, "good")); !os.IsNotExist(err) {
+		t.Errorf("Expected good to be gone from %s", a.Path)
+	}
+	if items, _ := ListTrash(a.Home); len(items) != 1 || items[0].Env != "good" || items[0].Path != item.Path {
+		t.Errorf("Expected good in the trash, found %v", items)
+	}
+	if err := RestoreTrash(a.Home, "app", "good"); err != nil {
+		t.Fatalf("Expected restore to succeed, received error %s", err.Error())
+	}
+	if _, err := os.Stat(path.Join(a.Path, "good")); err != nil {
+		t.Errorf("Expected good to be restored to %s", a.Path)
+	}
+	if err := RestoreTrash(a.Home, "app", "good"); err == nil {
+		t.Error("Expected error restoring an environment no longer in the trash but did not receive one")
+	}
+}
+
+func TestRemoveCurrentNeedsForce(t *testing.T) {
+	setUpTest()
+	a := setUpRollbackApp(t)
+	if err := a.MakeCurrent("good"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := a.Remove("good", false); err == nil {
+		t.Error("Expected error removing the current environment but did not receive one")
+	}
+	if _, err := a.Remove("good", true); err != nil {
+		t.Fatalf("Expected forced remove to succeed, received error %s", err.Error())
+	}
+	for _, link := range []string{path.Join(a.Path, "current"), a.Target} {
+		if _, err := os.Lstat(link); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be unlinked", link)
+		}
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	setUpTest()
+	a := setUpRollbackApp(t)
+	a.Remove("good", false)
+	a.Remove("broken", false)
+	if purged, err := PurgeTrash(a.Home, "app"); err != nil || len(purged) != 2 {
+		t.Errorf("Expected two environments purged, found %v %v", purged, err)
+	}
+	if items, _ := ListTrash(a.Home); len(items) != 0 {
+		t.Errorf("Expected empty trash, found %v", items)
+	}
+}
+
+func TestRemoveRejectsInvalidNames(t *testing.T) {
+	setUpTest()
+	a := setUpRollbackApp(t)
+	os.MkdirAll(path.Join(a.Path, "good/nested"), 0755)
+	for _, envName := range []string{"", ".", "..", "current", "good/nested", "../app/good"} {
+		if _, err := a.Remove(envName, true); err == nil || !strings.Contains(err.Error(), "not a valid") {
+			t.Errorf("Expected %q to be rejected as an environment name, received %v", envName, err)
+		}
+	}
+	if _, err := os.Stat(path.Join(a.Path, "good/nested")); err != nil {
+		t.Errorf("Expected good/nested to be left alone, found %v", err)
+	}
+}
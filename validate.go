@@ -0,0 +1,278 @@
+package sellsword
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Problem is something wrong with an application definition. Line is 0 when the
+// problem cannot be pinned to a line
+type Problem struct {
+	File   string
+	Line   int
+	Reason string
+}
+
+func (p Problem) String() string {
+	if p.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Reason)
+	}
+	return fmt.Sprintf("%s: %s", p.File, p.Reason)
+}
+
+var definitionKeys = []string{"type", "target", "targets", "variables", "secrets", "confirm_secrets",
+	"template", "load", "unload", "separator", "format"}
+
+var variableKeys = []string{"key", "env", "description", "default", "pattern", "choices", "required", "secret", "separator"}
+
+var envTypes = []string{"environment", "directory", "file"}
+
+var yamlErrorLine = regexp.MustCompile(`^line (\d+): `)
+
+// definitionChecker collects the problems of one definition file, using the raw
+// text to find the line of each problem as the yaml package does not tell us
+type definitionChecker struct {
+	file     string
+	lines    []string
+	problems []Problem
+}
+
+func (c *definitionChecker) add(line int, format string, args ...interface{}) {
+	c.problems = append(c.problems, Problem{File: c.file, Line: line, Reason: fmt.Sprintf(format, args...)})
+}
+
+// keyLine returns the line of the top-level key, or 0 if it is not there
+func (c *definitionChecker) keyLine(key string) int {
+	pattern := regexp.MustCompile(`^` + regexp.QuoteMeta(key) + `\s*:`)
+	for i := range c.lines {
+		if pattern.MatchString(c.lines[i]) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// lineOf returns the line of the nth occurrence of text at or after line from,
+// falling back to from
+func (c *definitionChecker) lineOf(from int, text string, nth int) int {
+	start := from - 1
+	if start < 0 {
+		start = 0
+	}
+	for i := start; i < len(c.lines); i++ {
+		if strings.Contains(c.lines[i], text) {
+			if nth == 0 {
+				return i + 1
+			}
+			nth--
+		}
+	}
+	return from
+}
+
+// ValidateDefinition checks the definition of the application name and returns
+// every problem found
+func ValidateDefinition(sswHome string, name string) []Problem {
+	file := path.Join(sswHome, "config", name+".ssw")
+	c := &definitionChecker{file: file}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		c.add(0, "%s", err.Error())
+		return c.problems
+	}
+	c.lines = strings.Split(string(data), "\n")
+	var top yaml.MapSlice
+	if err := yaml.Unmarshal(data, &top); err != nil {
+		line := 0
+		reason := strings.TrimPrefix(err.Error(), "yaml: ")
+		if m := yamlErrorLine.FindStringSubmatch(reason); m != nil {
+			line, _ = strconv.Atoi(m[1])
+			reason = reason[len(m[0]):]
+		}
+		c.add(line, "%s", reason)
+		return c.problems
+	}
+	for _, item := range top {
+		key := fmt.Sprintf("%v", item.Key)
+		if !contains(definitionKeys, key) {
+			c.add(c.keyLine(key), "unknown key %s, expected one of %s", key, strings.Join(definitionKeys, ", "))
+		}
+	}
+	// nested maps come out as MapSlices too, which are more work to look into
+	values := make(map[string]interface{}, len(top))
+	yaml.Unmarshal(data, &values)
+	envType, _ := values["type"].(string)
+	if _, ok := values["type"]; !ok {
+		c.add(0, "type is missing, expected one of %s", strings.Join(envTypes, ", "))
+	} else if !contains(envTypes, envType) {
+		c.add(c.keyLine("type"), "unknown type %v, expected one of %s", values["type"], strings.Join(envTypes, ", "))
+	}
+	if format, ok := values["format"]; ok && !contains(envFormats, fmt.Sprintf("%v", format)) {
+		c.add(c.keyLine("format"), "unknown format %v, expected one of %s", format, strings.Join(envFormats, ", "))
+	}
+	if envType == "directory" || envType == "file" {
+		c.checkTargets(values)
+	} else if envType == "environment" {
+		c.checkVariables(values)
+	}
+	if len(c.problems) == 0 {
+		// anything the checks above do not know about
+		if _, err := NewApp(name, sswHome); err != nil {
+			c.add(0, "%s", err.Error())
+		}
+	}
+	sort.Stable(byLine(c.problems))
+	return c.problems
+}
+
+type byLine []Problem
+
+func (p byLine) Len() int           { return len(p) }
+func (p byLine) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p byLine) Less(i, j int) bool { return p[i].Line < p[j].Line }
+
+func (c *definitionChecker) checkTargets(values map[string]interface{}) {
+	targets := make(map[string]int)
+	if target, ok := values["target"]; ok {
+		if s, ok := target.(string); !ok || s == "" {
+			c.add(c.keyLine("target"), "target must be a path")
+		} else if expanded, err := expandPath(s); err == nil {
+			targets[expanded] = c.keyLine("target")
+		}
+	}
+	entries, ok := values["targets"].([]interface{})
+	if _, present := values["targets"]; present && !ok {
+		c.add(c.keyLine("targets"), "targets must be a list of source -> target entries")
+	}
+	if len(targets) == 0 && len(entries) == 0 {
+		c.add(0, "target or targets is missing, applications of type %v need somewhere to link environments",
+			values["type"])
+	}
+	seen := make(map[string]int)
+	for _, entry := range entries {
+		s := fmt.Sprintf("%v", entry)
+		line := c.lineOf(c.keyLine("targets"), s, seen[s])
+		seen[s]++
+		m, err := parseMapping(s)
+		if err != nil {
+			c.add(line, "%s", err.Error())
+			continue
+		}
+		if first, ok := targets[m.Target]; ok {
+			c.add(line, "target %s is already linked on line %d", m.Target, first)
+			continue
+		}
+		targets[m.Target] = line
+	}
+}
+
+func (c *definitionChecker) checkVariables(values map[string]interface{}) {
+	entries, ok := values["variables"].([]interface{})
+	if !ok || len(entries) == 0 {
+		c.add(c.keyLine("variables"), "variables is missing, applications of type environment need a list of variables")
+		return
+	}
+	from := c.keyLine("variables")
+	// the line and the key each environment variable is first exported for, as
+	// a variable listed more than once may export the same name again
+	envNames := make(map[string]int)
+	envKeys := make(map[string]string)
+	keys := make([]string, 0)
+	seen := make(map[string]int)
+	for i, entry := range entries {
+		var key string
+		var names []string
+		var line int
+		switch e := entry.(type) {
+		case string:
+			line = c.lineOf(from, e, seen[e])
+			seen[e]++
+			keyValue := strings.SplitN(e, "=", 2)
+			if len(keyValue) != 2 {
+				c.add(line, "variable %s is not of the form key=ENV_NAME", e)
+				continue
+			}
+			key = strings.TrimSpace(keyValue[0])
+			names = []string{strings.TrimSpace(keyValue[1])}
+		case map[interface{}]interface{}:
+			key, _ = e["key"].(string)
+			line = c.lineOf(from, "key: "+key, seen["key: "+key])
+			seen["key: "+key]++
+			if key == "" {
+				line = from
+				c.add(line, "variable %d has no key", i+1)
+			}
+			unknown := make([]string, 0)
+			for k := range e {
+				if !contains(variableKeys, fmt.Sprintf("%v", k)) {
+					unknown = append(unknown, fmt.Sprintf("%v", k))
+				}
+			}
+			sort.Strings(unknown)
+			for _, k := range unknown {
+				c.add(c.lineOf(line, k+":", 0), "unknown key %s for variable %s, expected one of %s",
+					k, key, strings.Join(variableKeys, ", "))
+			}
+			switch env := e["env"].(type) {
+			case string:
+				names = []string{env}
+			case []interface{}:
+				for _, name := range env {
+					names = append(names, fmt.Sprintf("%v", name))
+				}
+			default:
+				c.add(line, "variable %s needs env, the environment variables it is exported as", key)
+			}
+			if pattern, ok := e["pattern"].(string); ok {
+				if _, err := regexp.Compile(pattern); err != nil {
+					c.add(c.lineOf(line, "pattern:", 0), "pattern of variable %s is not a valid regular expression: %s",
+						key, err.Error())
+				}
+			}
+		default:
+			c.add(from, "variable %d must be a key=ENV_NAME string or a map", i+1)
+			continue
+		}
+		if key == extendsKey {
+			c.add(line, "variable %s cannot be called %s, environments use it to name the environment they extend",
+				key, extendsKey)
+		}
+		keys = append(keys, key)
+		for _, name := range names {
+			if !isValidIdentifier(name) {
+				c.add(line, "%s is not a valid environment variable name", name)
+			} else if first, ok := envNames[name]; ok && envKeys[name] != key {
+				c.add(line, "environment variable %s is already exported on line %d", name, first)
+			} else if !ok {
+				envNames[name], envKeys[name] = line, key
+			}
+		}
+	}
+	if secrets, ok := values["secrets"].([]interface{}); ok {
+		for _, secret := range secrets {
+			if !contains(keys, fmt.Sprintf("%v", secret)) {
+				c.add(c.lineOf(c.keyLine("secrets"), fmt.Sprintf("%v", secret), 0),
+					"secret %v is not one of the variables", secret)
+			}
+		}
+	}
+}
+
+// DefinedApps lists the applications with a definition in the config directory
+func DefinedApps(sswHome string) []string {
+	names := make([]string, 0)
+	di, _ := ioutil.ReadDir(path.Join(sswHome, "config"))
+	for i := range di {
+		if strings.HasSuffix(di[i].Name(), ".ssw") {
+			names = append(names, strings.TrimSuffix(di[i].Name(), ".ssw"))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,83 @@
+package sellsword
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestValidateDefinitionProblems(t *testing.T) {
+	setUpTest()
+	cases := []struct {
+		definition string
+		line       int
+		reason     string
+	}{
+		{"type: environment\nvariables:\n  - access_key=AWS_ACCESS_KEY_ID\n  - region AWS_REGION\n",
+			4, "not of the form key=ENV_NAME"},
+		{"type: environment\nvariables:\n  - access_key=AWS_KEY\n  - secret_key=AWS_KEY\n",
+			4, "AWS_KEY is already exported on line 3"},
+		{"type: environment\nvariables:\n  - region=AWS_REGION\n  - key: region\n    env: AWS_REGION\n" +
+			"  - region=REGION\n  - zone=REGION\n", 7, "REGION is already exported on line 6"},
+		{"type: environmnet\n", 1, "unknown type environmnet"},
+		{"type: directory\n", 0, "target or targets is missing"},
+		{"type: directory\ntargets:\n  - config -> ~/.kube/config\n  - certs ~/.certs\n",
+			4, "not of the form source -> target"},
+		{"type: directory\ntarget: ~/.chef\nlaod: echo hi\n", 3, "unknown key laod"},
+		{"type: environment\nvariables:\n  - key: region\n    env: AWS_REGION\n    requried: false\n",
+			5, "unknown key requried for variable region"},
+		{"type: directory\ntarget: ~/.chef\n  bad: [indent\n", 2, "mapping values are not allowed"},
+	}
+	for i, c := range cases {
+		home := setUpHome(t, "app", c.definition, nil)
+		problems := ValidateDefinition(home, "app")
+		found := false
+		for _, p := range problems {
+			if p.Line == c.line && strings.Contains(p.Reason, c.reason) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Case %d: expected a problem on line %d about %q, found %v", i, c.line, c.reason, problems)
+		}
+	}
+}
+
+func TestValidateRepeatedVariableLikeTheLoader(t *testing.T) {
+	setUpTest()
+	home := setUpHome(t, "app", "type: environment\nvariables:\n  - region=AWS_REGION\n"+
+		"  - key: region\n    env: AWS_REGION\n    required: true\n", nil)
+	if problems := ValidateDefinition(home, "app"); len(problems) != 0 {
+		t.Errorf("Expected a variable listed twice with the same environment variable to be valid, found %v",
+			problems)
+	}
+	if _, err := NewApp("app", home); err != nil {
+		t.Errorf("Expected the application to load, received error %s", err.Error())
+	}
+}
+
+func TestValidateDefinitionOk(t *testing.T) {
+	setUpTest()
+	wd, _ := os.Getwd()
+	home := path.Join(wd, "test")
+	for _, name := range DefinedApps(home) {
+		if problems := ValidateDefinition(home, name); len(problems) != 0 {
+			t.Errorf("Expected definition of %s to be valid, found %v", name, problems)
+		}
+	}
+}
+
+func TestFindAppsReportsBrokenDefinitions(t *testing.T) {
+	setUpTest()
+	home := setUpHome(t, "broken", "type: environment\nvariables:\n  - region=AWS-REGION\n", nil)
+	addApp(t, home, "good", "type: environment\nvariables:\n  - region=AWS_REGION\n", nil)
+	as, _ := NewAppSet(home)
+	err := as.FindApps("broken", "good")
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("Expected error naming the broken application, found %v", err)
+	}
+	if len(as.Apps) != 1 || as.Apps[0].Name != "good" {
+		t.Errorf("Expected only the good application to be found, found %v", as.Apps)
+	}
+}
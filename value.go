@@ -0,0 +1,82 @@
+package sellsword
+
+import (
+	"errors"
+	"fmt"
+	"github.com/fatih/color"
+)
+
+// Get returns the value of the variable key, given by variable or environment
+// variable name, in the environment envName or, if envName is empty, in the
+// current environment. References to other values are resolved
+func (a *App) Get(envName string, key string) (string, error) {
+	env, err := a.valueEnv(envName)
+	if err != nil {
+		return "", err
+	}
+	name, ok := env.variableName(key)
+	if !ok {
+		return "", errors.New(fmt.Sprintf("%s is not a variable of application %s", key, a.Name))
+	}
+	if _, ok := env.Variables[name]; ok {
+		resolved, err := env.Resolved()
+		return resolved[name], err
+	}
+	return "", errors.New(fmt.Sprintf("Environment %s of application %s has no value for %s", env.Name, a.Name, name))
+}
+
+// Set changes variables of the environment envName, keyed by variable or
+// environment variable name. The environment is only saved if it still satisfies
+// the definition. If it is the current environment its variables are exported again.
+// The application is locked from reading the environment until it is saved
+func (a *App) Set(envName string, values map[string]string) error {
+	unlock, err := a.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	env, err := a.valueEnv(envName)
+	if err != nil {
+		return err
+	}
+	resolved, err := env.resolveValues(values)
+	if err != nil {
+		return err
+	}
+	for k, v := range resolved {
+		env.Variables[k] = v
+		env.Sources[k] = env.Name
+	}
+	if err := env.Validate(); err != nil {
+		return err
+	}
+	if err := env.Save(); err != nil {
+		return err
+	}
+	green := GetTermPrinterF(color.FgGreen)
+	fmt.Fprint(Out, green("Updated environment %s of application %s\n", env.Name, a.Name))
+	if linksTo(a.currentLink(), env.Name) {
+		a.UnsetExportVars()
+		env.Load()
+	}
+	return nil
+}
+
+// valueEnv returns the environment envName, or the current one if envName is
+// empty, of an application of type environment
+func (a *App) valueEnv(envName string) (*Env, error) {
+	if a.EnvType != "environment" {
+		return nil, errors.New(fmt.Sprintf("Application %s of type %s has no variables", a.Name, a.EnvType))
+	}
+	if envName == "" {
+		env, err := a.Current()
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Application %s has no current environment", a.Name))
+		}
+		return env, nil
+	}
+	if err := a.checkEnvExists(envName); err != nil {
+		return nil, err
+	}
+	return a.NewEnv(envName)
+}
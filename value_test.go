@@ -0,0 +1,86 @@
+package sellsword
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	setUpTest()
+	a := setUpApp(t, "aws", schemaDefinition, nil)
+	ioutil.WriteFile(path.Join(a.Path, "dev"), []byte("access_key: AKIA\nregion: us-east-1\ntier: dev\n"), 0644)
+	if _, err := a.Get("", "region"); err == nil {
+		t.Error("Expected error getting a value without a current environment but did not receive one")
+	}
+	a.MakeCurrent("dev")
+	for _, key := range []string{"region", "AWS_DEFAULT_REGION"} {
+		if value, err := a.Get("", key); err != nil || value != "us-east-1" {
+			t.Errorf("Expected %s to be us-east-1, found %q %v", key, value, err)
+		}
+	}
+	if _, err := a.Get("dev", "profile"); err == nil {
+		t.Error("Expected error getting a value that is not set but did not receive one")
+	}
+	if _, err := a.Get("dev", "nope"); err == nil {
+		t.Error("Expected error getting an unknown variable but did not receive one")
+	}
+}
+
+func TestSet(t *testing.T) {
+	setUpTest()
+	a := setUpApp(t, "aws", schemaDefinition, nil)
+	envPath := path.Join(a.Path, "dev")
+	ioutil.WriteFile(envPath, []byte("access_key: AKIA\nregion: us-east-1\ntier: dev\n"), 0644)
+	a.MakeCurrent("dev")
+	var out bytes.Buffer
+	EvalOut = &out
+	defer func() { EvalOut = os.Stdout }()
+	if err := a.Set("dev", map[string]string{"region": "moon"}); err == nil {
+		t.Error("Expected error setting an invalid value but did not receive one")
+	}
+	if err := a.Set("dev", map[string]string{"AWS_REGION": "eu-west-1", "tier": "qa"}); err != nil {
+		t.Fatalf("Expected set to succeed, received error %s", err.Error())
+	}
+	if value, _ := a.Get("dev", "region"); value != "eu-west-1" {
+		t.Errorf("Expected region to be eu-west-1, found %s", value)
+	}
+	if !strings.Contains(out.String(), "AWS_REGION=eu-west-1") {
+		t.Errorf("Expected current env to be exported again, found %s", out.String())
+	}
+}
+
+func TestSetKeepsSecretsPrivate(t *testing.T) {
+	setUpTest()
+	a := setUpApp(t, "aws", "type: environment\nvariables:\n  - access_key=AWS_ACCESS_KEY_ID\n"+
+		"  - secret_key=AWS_SECRET_ACCESS_KEY\nsecrets:\n  - secret_key\n", acmeKeys)
+	if err := a.Set("acme", map[string]string{"secret_key": "hunter3"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if fi, _ := os.Stat(path.Join(a.Path, "acme")); fi == nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("Expected environment with secrets to be readable only by its owner, found %v", fi)
+	}
+}
+
+func TestSetKeepsFileMode(t *testing.T) {
+	setUpTest()
+	a := setUpApp(t, "aws", "type: environment\nvariables:\n  - access_key=AWS_ACCESS_KEY_ID\n"+
+		"  - secret_key=AWS_SECRET_ACCESS_KEY\n", acmeKeys)
+	os.Chmod(path.Join(a.Path, "acme"), 0640)
+	if err := a.Set("acme", map[string]string{"access_key": "AKIB"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if fi, _ := os.Stat(path.Join(a.Path, "acme")); fi == nil || fi.Mode().Perm() != 0640 {
+		t.Errorf("Expected environment to keep its mode 0640, found %v", fi)
+	}
+	env, _ := a.NewEnv("new")
+	if err := env.Construct(map[string]string{"access_key": "AKIC", "secret_key": "hunter2"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if fi, _ := os.Stat(env.Path); fi == nil || fi.Mode().Perm() != 0644 {
+		t.Errorf("Expected new environment to be saved with mode 0644, found %v", fi)
+	}
+}
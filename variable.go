@@ -0,0 +1,159 @@
+package sellsword
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Variable describes one variable of an environment application. In a
+// definition it is either a string of the form key=ENV_NAME or a map
+//
+//   - key: region
+//     env: [AWS_REGION, AWS_DEFAULT_REGION]
+//     description: AWS region
+//     default: us-east-1
+//     pattern: '[a-z]+-[a-z]+-[0-9]'
+//     choices: [us-east-1, eu-west-1]
+//     required: true
+//     secret: false
+//     separator: ','
+//
+// Variables are optional unless they say otherwise
+type Variable struct {
+	Key         string
+	Env         envNames
+	Description string
+	Default     string
+	Pattern     string
+	Choices     []string
+	Required    *bool
+	Secret      bool
+	Separator   string
+	pattern     *regexp.Regexp
+}
+
+// envNames accepts a single environment variable name as well as a list
+type envNames []string
+
+func (n *envNames) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		*n = envNames{name}
+		return nil
+	}
+	var names []string
+	if err := unmarshal(&names); err != nil {
+		return err
+	}
+	*n = envNames(names)
+	return nil
+}
+
+func (v *Variable) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var spec string
+	if err := unmarshal(&spec); err == nil {
+		keyValue := strings.SplitN(spec, "=", 2)
+		if len(keyValue) != 2 {
+			return errors.New(fmt.Sprintf("Variable %s is not of the form key=ENV_NAME", spec))
+		}
+		v.Key = strings.TrimSpace(keyValue[0])
+		v.Env = envNames{strings.TrimSpace(keyValue[1])}
+		return nil
+	}
+	// a separate type so that unmarshal does not call us again
+	type variable Variable
+	return unmarshal((*variable)(v))
+}
+
+// IsRequired reports whether environments must have a value for the variable.
+// Only variables that set required: true are, so that environment files written
+// before the schema existed keep loading
+func (v *Variable) IsRequired() bool {
+	return v.Required != nil && *v.Required
+}
+
+// compile checks the variable is well formed and prepares its pattern
+func (v *Variable) compile() error {
+	if v.Key == "" {
+		return errors.New(fmt.Sprintf("Variable with environment variables %v has no key", []string(v.Env)))
+	}
+	if v.Pattern != "" {
+		pattern, err := regexp.Compile("^(?:" + v.Pattern + ")$")
+		if err != nil {
+			return errors.New(fmt.Sprintf("Pattern of variable %s is not a valid regular expression: %s",
+				v.Key, err.Error()))
+		}
+		v.pattern = pattern
+	}
+	if v.Default != "" {
+		if err := v.Validate(v.Default); err != nil {
+			return errors.New(fmt.Sprintf("Default of variable %s is not valid: %s", v.Key, err.Error()))
+		}
+	}
+	return nil
+}
+
+// merge adds the settings of another entry for the same key, as a key may be
+// listed once per environment variable it is exported as
+func (v *Variable) merge(other *Variable) {
+	for _, name := range other.Env {
+		v.Env = envNames(appendIfMissing([]string(v.Env), name))
+	}
+	if v.Description == "" {
+		v.Description = other.Description
+	}
+	if v.Default == "" {
+		v.Default = other.Default
+	}
+	if v.Pattern == "" {
+		v.Pattern = other.Pattern
+	}
+	if len(v.Choices) == 0 {
+		v.Choices = other.Choices
+	}
+	if v.Required == nil {
+		v.Required = other.Required
+	}
+	v.Secret = v.Secret || other.Secret
+	if v.Separator == "" {
+		v.Separator = other.Separator
+	}
+}
+
+// Validate reports an error if value is not acceptable for the variable
+func (v *Variable) Validate(value string) error {
+	if value == "" {
+		if v.IsRequired() {
+			return errors.New(fmt.Sprintf("%s is required", v.Key))
+		}
+		return nil
+	}
+	if v.pattern != nil && !v.pattern.MatchString(value) {
+		return errors.New(fmt.Sprintf("%s does not match the pattern %s", v.Key, v.Pattern))
+	}
+	if len(v.Choices) > 0 && !contains(v.Choices, value) {
+		return errors.New(fmt.Sprintf("%s must be one of %s", v.Key, strings.Join(v.Choices, ", ")))
+	}
+	return nil
+}
+
+// prompt is what the user is asked when constructing an environment
+func (v *Variable) prompt() string {
+	prompt := v.Key
+	if v.Description != "" {
+		prompt = fmt.Sprintf("%s (%s)", v.Description, v.Key)
+	}
+	if len(v.Choices) > 0 {
+		prompt += fmt.Sprintf(" {%s}", strings.Join(v.Choices, ", "))
+	}
+	if v.Default != "" && v.Secret {
+		prompt += fmt.Sprintf(" [%s]", MaskedValue)
+	} else if v.Default != "" {
+		prompt += fmt.Sprintf(" [%s]", v.Default)
+	} else if !v.IsRequired() {
+		prompt += " (optional)"
+	}
+	return prompt
+}
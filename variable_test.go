@@ -0,0 +1,135 @@
+package sellsword
+
+import (
+	"github.com/mattn/go-isatty"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+const schemaDefinition = `type: environment
+variables:
+  - access_key=AWS_ACCESS_KEY_ID
+  - key: region
+    env: [AWS_REGION, AWS_DEFAULT_REGION]
+    description: AWS region
+    default: us-east-1
+    pattern: '[a-z]+-[a-z]+-[0-9]'
+    required: true
+  - key: tier
+    env: TIER
+    choices: [dev, qa, prod]
+    required: true
+  - key: profile
+    env: AWS_PROFILE
+    required: false
+`
+
+func TestVariableSchema(t *testing.T) {
+	setUpTest()
+	a := setUpApp(t, "aws", schemaDefinition, nil)
+	if strings.Join(a.VariableNames, ",") != "access_key,region,tier,profile" {
+		t.Errorf("Expected variables in definition order, found %v", a.VariableNames)
+	}
+	if a.ExportVariables["AWS_DEFAULT_REGION"] != "region" || a.ExportVariables["TIER"] != "tier" {
+		t.Errorf("Expected region and tier to be exported, found %v", a.ExportVariables)
+	}
+	region := a.Schema["region"]
+	if region.Description != "AWS region" || region.Default != "us-east-1" || !region.IsRequired() {
+		t.Errorf("Expected region schema to be parsed, found %v", region)
+	}
+	if a.Schema["profile"].IsRequired() {
+		t.Error("Expected profile to be optional")
+	}
+}
+
+func TestVariableValidate(t *testing.T) {
+	setUpTest()
+	a := setUpApp(t, "aws", schemaDefinition, nil)
+	cases := []struct {
+		key   string
+		value string
+		valid bool
+	}{
+		{"region", "eu-west-1", true},
+		{"region", "eu-west", false},
+		{"region", "xeu-west-1x", false},
+		{"region", "", false},
+		{"tier", "qa", true},
+		{"tier", "staging", false},
+		{"profile", "", true},
+	}
+	for _, c := range cases {
+		err := a.Schema[c.key].Validate(c.value)
+		if c.valid && err != nil {
+			t.Errorf("Expected %s=%q to be valid, received error %s", c.key, c.value, err.Error())
+		} else if !c.valid && err == nil {
+			t.Errorf("Expected %s=%q to be invalid but it was accepted", c.key, c.value)
+		}
+	}
+}
+
+func TestConstructUsesDefaultsAndValidates(t *testing.T) {
+	setUpTest()
+	if isatty.IsTerminal(os.Stdin.Fd()) {
+		t.Skip("Construct prompts instead of using defaults when stdin is a terminal")
+	}
+	a := setUpApp(t, "aws", schemaDefinition, nil)
+	env, _ := a.NewEnv("dev")
+	if err := env.Construct(map[string]string{"access_key": "AKIA", "tier": "staging"}); err == nil {
+		t.Error("Expected error for a value that is not one of the choices but did not receive one")
+	}
+	env, _ = a.NewEnv("dev")
+	if err := env.Construct(map[string]string{"access_key": "AKIA", "tier": "dev"}); err != nil {
+		t.Fatalf("Expected env to be constructed, received error %s", err.Error())
+	}
+	env, _ = a.NewEnv("dev")
+	if env.Variables["region"] != "us-east-1" {
+		t.Errorf("Expected region to default to us-east-1, found %v", env.Variables)
+	}
+	if _, ok := env.Variables["profile"]; ok {
+		t.Errorf("Expected optional profile to be left out, found %v", env.Variables)
+	}
+}
+
+func TestLoadRejectsInvalidEnv(t *testing.T) {
+	setUpTest()
+	a := setUpApp(t, "aws", schemaDefinition, nil)
+	ioutil.WriteFile(path.Join(a.Path, "bad"), []byte("access_key: AKIA\nregion: moon\ntier: dev\n"), 0644)
+	err := a.MakeCurrent("bad")
+	if err == nil {
+		t.Fatal("Expected error using an env that violates the schema but did not receive one")
+	}
+	if !strings.Contains(err.Error(), path.Join(a.Path, "bad")) || !strings.Contains(err.Error(), "region") {
+		t.Errorf("Expected error to name the env file and the variable, found %s", err.Error())
+	}
+}
+
+func TestVariableRejectsBadPattern(t *testing.T) {
+	a := &App{Name: "aws"}
+	yaml.Unmarshal([]byte("variables:\n  - {key: region, env: AWS_REGION, pattern: '[a-'}\n"), a)
+	if err := a.ParseExportVars(); err == nil {
+		t.Error("Expected error for an invalid pattern but did not receive one")
+	}
+}
+
+func TestStringVariablesAreOptional(t *testing.T) {
+	setUpTest()
+	wd, _ := os.Getwd()
+	a, _ := NewApp("aws", path.Join(wd, "test"))
+	// acme predates the schema and has no access_key or secret_key
+	env, err := a.NewEnv("acme")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := env.Validate(); err != nil {
+		t.Errorf("Expected acme to satisfy a definition of key=ENV_NAME variables, found %v", err)
+	}
+	env.PopulateExportVars()
+	if env.ExportVariables["AWS_DEFAULT_REGION"] != "nowhere" {
+		t.Errorf("Expected AWS_DEFAULT_REGION to be exported, found %v", env.ExportVariables)
+	}
+}